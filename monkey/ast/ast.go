@@ -2,6 +2,9 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
 
 	"github.com/fandan-nyc/all-interpretors/monkey/token"
 )
@@ -9,6 +12,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of the first char of the node
+	End() token.Position // position right after the last char of the node
 }
 
 type Statement interface {
@@ -38,6 +43,20 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -47,14 +66,25 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// let statement also covers const x = y, which only differs in the token
 type LetStatement struct {
-	Token token.Token // this is LET
+	Token token.Token // this is LET or CONST
 	Name  *Identifier
 	Value Expression
 }
 
 func (lt *LetStatement) StatementNode()       {}
 func (lt *LetStatement) TokenLiteral() string { return lt.Token.Literal }
+func (lt *LetStatement) Pos() token.Position  { return lt.Token.Pos }
+func (lt *LetStatement) End() token.Position {
+	if lt.Value != nil {
+		return lt.Value.End()
+	}
+	if lt.Name != nil {
+		return lt.Name.End()
+	}
+	return lt.Token.End
+}
 
 func (lt *LetStatement) String() string {
 	var out bytes.Buffer
@@ -77,22 +107,31 @@ type Identifier struct {
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 func (i *Identifier) ExpressionNode()      {}
 func (i *Identifier) String() string       { return i.Value }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
+func (i *Identifier) End() token.Position  { return i.Token.End }
 
 // why the identifier is an Expression
 // this is just to keep things simple. identifier in other parts do produce values
 
 type ReturnStatement struct {
 	Token       token.Token
-	ReturnValue Expression
+	ReturnValue Expression // nil for a bare return
 }
 
 func (rs *ReturnStatement) StatementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
-	out.WriteString(rs.Token.Literal + " ")
+	out.WriteString(rs.Token.Literal)
 	if rs.ReturnValue != nil {
-		out.WriteString(rs.ReturnValue.String())
+		out.WriteString(" " + rs.ReturnValue.String())
 	}
 	out.WriteString(";")
 	return out.String()
@@ -107,6 +146,57 @@ type IntegerLiteral struct {
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) ExpressionNode()      {}
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position  { return il.Token.End }
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) ExpressionNode()      {}
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position  { return fl.Token.End }
+
+type StringLiteral struct {
+	Token token.Token
+	Value string // with the escape sequences already resolved
+}
+
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) ExpressionNode()      {}
+func (sl *StringLiteral) String() string       { return quote(sl.Value) }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position  { return sl.Token.End }
+
+// quote writes s as a monkey string literal. it only uses the escapes the
+// lexer knows, so the printed program parses back to the same string.
+func quote(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case unicode.IsPrint(r):
+			out.WriteRune(r)
+		default:
+			// a byte that is not UTF-8 comes out as utf8.RuneError
+			fmt.Fprintf(&out, `\u{%x}`, r)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
 
 type ExpressionStatement struct {
 	Token      token.Token
@@ -115,6 +205,13 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) StatementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -123,13 +220,21 @@ func (es *ExpressionStatement) String() string {
 }
 
 type PrefixExpression struct {
-	Token    token.Token
-	Operator string
-	Right    Expression
+	Token      token.Token
+	Operator   string
+	Right      Expression
+	RightParen token.Token // the ) closing Right, when it is in parentheses
 }
 
 func (pe *PrefixExpression) ExpressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right != nil {
+		return endOf(pe.Right, pe.RightParen)
+	}
+	return pe.Token.End
+}
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -142,14 +247,28 @@ func (pe *PrefixExpression) String() string {
 }
 
 type InfixExpression struct {
-	Token    token.Token
-	Left     Expression
-	Operator string
-	Right    Expression
+	Token      token.Token
+	Left       Expression
+	Operator   string
+	Right      Expression
+	LeftParen  token.Token // the ( opening Left, when it is in parentheses
+	RightParen token.Token // the ) closing Right, when it is in parentheses
 }
 
 func (ie *InfixExpression) ExpressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return startOf(ie.Left, ie.LeftParen)
+	}
+	return ie.Token.Pos
+}
+func (ie *InfixExpression) End() token.Position {
+	if ie.Right != nil {
+		return endOf(ie.Right, ie.RightParen)
+	}
+	return ie.Token.End
+}
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -159,3 +278,374 @@ func (ie *InfixExpression) String() string {
 	out.WriteString(")")
 	return out.String()
 }
+
+type Boolean struct {
+	Token token.Token
+	Value bool
+}
+
+func (b *Boolean) ExpressionNode()      {}
+func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) String() string       { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
+func (b *Boolean) End() token.Position  { return b.Token.End }
+
+// block statement is the `{ ... }` body of if/else and function literals
+type BlockStatement struct {
+	Token      token.Token // this is {
+	Statements []Statement
+	Rbrace     token.Token // the closing }
+}
+
+func (bs *BlockStatement) StatementNode()       {}
+func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position  { return bs.Rbrace.End }
+func (bs *BlockStatement) String() string {
+	var out bytes.Buffer
+	for _, s := range bs.Statements {
+		out.WriteString(s.String())
+	}
+	return out.String()
+}
+
+// if is an expression in monkey: `let x = if (a) { 1 } else { 2 };`
+type IfExpression struct {
+	Token       token.Token // this is IF
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+func (ie *IfExpression) ExpressionNode()      {}
+func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	return ie.Consequence.End()
+}
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("if")
+	out.WriteString(ie.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ie.Consequence.String())
+	if ie.Alternative != nil {
+		out.WriteString("else ")
+		out.WriteString(ie.Alternative.String())
+	}
+	return out.String()
+}
+
+type FunctionLiteral struct {
+	Token      token.Token // this is FUNCTION
+	Name       string      // the let it is bound by, if any
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (fl *FunctionLiteral) ExpressionNode()      {}
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position  { return fl.Body.End() }
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fl.Body.String())
+	return out.String()
+}
+
+type CallExpression struct {
+	Token     token.Token // this is (
+	Function  Expression  // identifier or function literal
+	Arguments []Expression
+	Rparen    token.Token // the closing )
+	LeftParen token.Token // the ( opening Function, when it is in parentheses
+}
+
+func (ce *CallExpression) ExpressionNode()      {}
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Function != nil {
+		return startOf(ce.Function, ce.LeftParen)
+	}
+	return ce.Token.Pos
+}
+func (ce *CallExpression) End() token.Position { return ce.Rparen.End }
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+	return out.String()
+}
+
+// assign expression covers x = y, x += y and x -= y. it is an expression,
+// so its value is the new value of the target.
+type AssignExpression struct {
+	Token      token.Token // the operator token
+	Target     Expression  // an identifier or an index expression
+	Operator   string
+	Value      Expression
+	LeftParen  token.Token // the ( opening Target, when it is in parentheses
+	RightParen token.Token // the ) closing Value, when it is in parentheses
+}
+
+func (ae *AssignExpression) ExpressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position {
+	if ae.Target != nil {
+		return startOf(ae.Target, ae.LeftParen)
+	}
+	return ae.Token.Pos
+}
+func (ae *AssignExpression) End() token.Position {
+	if ae.Value != nil {
+		return endOf(ae.Value, ae.RightParen)
+	}
+	return ae.Token.End
+}
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+type ArrayLiteral struct {
+	Token    token.Token // this is [
+	Elements []Expression
+	Rbracket token.Token // the closing ]
+}
+
+func (al *ArrayLiteral) ExpressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position  { return al.Rbracket.End }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+// index expression is arr[i]
+type IndexExpression struct {
+	Token     token.Token // this is [
+	Left      Expression
+	Index     Expression
+	Rbracket  token.Token // the closing ]
+	LeftParen token.Token // the ( opening Left, when it is in parentheses
+}
+
+func (ie *IndexExpression) ExpressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return startOf(ie.Left, ie.LeftParen)
+	}
+	return ie.Token.Pos
+}
+func (ie *IndexExpression) End() token.Position { return ie.Rbracket.End }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+	return out.String()
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+// hash literal is {key: value, ...}. the pairs are a slice rather than a
+// map so they keep the order they were written in.
+type HashLiteral struct {
+	Token  token.Token // this is {
+	Pairs  []HashPair
+	Rbrace token.Token // the closing }
+}
+
+func (hl *HashLiteral) ExpressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position  { return hl.Rbrace.End }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+type WhileStatement struct {
+	Token     token.Token // this is WHILE
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) StatementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+func (ws *WhileStatement) End() token.Position  { return ws.Body.End() }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("while (")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(") {")
+	out.WriteString(ws.Body.String())
+	out.WriteString("}")
+	return out.String()
+}
+
+// for statement is for (x in iterable) { ... }
+type ForStatement struct {
+	Token    token.Token // this is FOR
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) StatementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForStatement) End() token.Position  { return fs.Body.End() }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for (")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") {")
+	out.WriteString(fs.Body.String())
+	out.WriteString("}")
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token // this is BREAK
+}
+
+func (bs *BreakStatement) StatementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) End() token.Position  { return bs.Token.End }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal + ";" }
+
+type ContinueStatement struct {
+	Token token.Token // this is CONTINUE
+}
+
+func (cs *ContinueStatement) StatementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) End() token.Position  { return cs.Token.End }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal + ";" }
+
+type ThrowStatement struct {
+	Token token.Token // this is THROW
+	Value Expression
+}
+
+func (ts *ThrowStatement) StatementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *ThrowStatement) End() token.Position {
+	if ts.Value != nil {
+		return ts.Value.End()
+	}
+	return ts.Token.End
+}
+func (ts *ThrowStatement) String() string {
+	return ts.Token.Literal + " " + ts.Value.String() + ";"
+}
+
+// try is an expression like if: its value is the value of the try block,
+// or of the catch block when the try block failed. either Catch or Finally
+// can be left out, not both.
+type TryExpression struct {
+	Token   token.Token // this is TRY
+	Block   *BlockStatement
+	Param   *Identifier // the name the caught error is bound to
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (te *TryExpression) ExpressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Pos() token.Position  { return te.Token.Pos }
+func (te *TryExpression) End() token.Position {
+	if te.Finally != nil {
+		return te.Finally.End()
+	}
+	if te.Catch != nil {
+		return te.Catch.End()
+	}
+	return te.Block.End()
+}
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try {")
+	out.WriteString(te.Block.String())
+	out.WriteString("}")
+	if te.Catch != nil {
+		out.WriteString(" catch (")
+		out.WriteString(te.Param.String())
+		out.WriteString(") {")
+		out.WriteString(te.Catch.String())
+		out.WriteString("}")
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally {")
+		out.WriteString(te.Finally.String())
+		out.WriteString("}")
+	}
+	return out.String()
+}
+
+// the parentheses around an operand are not a node of their own, so the
+// expression around it keeps them to take them into its span
+
+func startOf(operand Expression, lparen token.Token) token.Position {
+	if lparen.Type == token.LPAREN {
+		return lparen.Pos
+	}
+	return operand.Pos()
+}
+
+func endOf(operand Expression, rparen token.Token) token.Position {
+	if rparen.Type == token.RPAREN {
+		return rparen.End
+	}
+	return operand.End()
+}
@@ -0,0 +1,262 @@
+// Package code defines the bytecode instruction set. an instruction is an
+// opcode byte followed by its operands, big endian.
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+// String lists one instruction per line, prefixed with its offset
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		i += 1 + read
+	}
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	// binary operators pop the right operand, then the left one
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPow
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpLessEqual
+	OpGreaterThan
+	OpGreaterEqual
+
+	OpMinus
+	OpBang
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpJump
+	OpJumpNotTruthy
+
+	OpGetGlobal
+	OpSetGlobal
+
+	// a local that a closure captures lives in a cell, so the function and
+	// the closure share it. the compiler patches the local instructions of
+	// such a variable into the cell ones.
+	OpGetLocal
+	OpSetLocal
+	OpGetCell
+	OpSetCell
+	OpLoadCell   // pushes the cell itself, to build a closure
+	OpResetLocal // forgets a cell, so the next loop iteration gets a new variable
+
+	OpGetFree
+	OpSetFree
+	OpLoadFree // pushes the cell itself, to build a closure
+
+	OpGetBuiltin
+
+	OpArray
+	OpHash
+	OpIndex
+	OpSetIndex // the operand is the operator of a compound assignment, or 0
+
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpClosure
+
+	OpIter     // replaces an array, hash or string by an iterator
+	OpIterNext // pops the iterator, pushes its next item or jumps when it is done
+
+	OpThrow
+	OpTry    // starts a try block, the operand is where its handler starts
+	OpEndTry // ends the innermost try block
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int // in bytes
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:      {"OpConstant", []int{2}},
+	OpPop:           {"OpPop", []int{}},
+	OpAdd:           {"OpAdd", []int{}},
+	OpSub:           {"OpSub", []int{}},
+	OpMul:           {"OpMul", []int{}},
+	OpDiv:           {"OpDiv", []int{}},
+	OpMod:           {"OpMod", []int{}},
+	OpPow:           {"OpPow", []int{}},
+	OpEqual:         {"OpEqual", []int{}},
+	OpNotEqual:      {"OpNotEqual", []int{}},
+	OpLessThan:      {"OpLessThan", []int{}},
+	OpLessEqual:     {"OpLessEqual", []int{}},
+	OpGreaterThan:   {"OpGreaterThan", []int{}},
+	OpGreaterEqual:  {"OpGreaterEqual", []int{}},
+	OpMinus:         {"OpMinus", []int{}},
+	OpBang:          {"OpBang", []int{}},
+	OpTrue:          {"OpTrue", []int{}},
+	OpFalse:         {"OpFalse", []int{}},
+	OpNull:          {"OpNull", []int{}},
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpGetGlobal:     {"OpGetGlobal", []int{2}},
+	OpSetGlobal:     {"OpSetGlobal", []int{2}},
+	OpGetLocal:      {"OpGetLocal", []int{1}},
+	OpSetLocal:      {"OpSetLocal", []int{1}},
+	OpGetCell:       {"OpGetCell", []int{1}},
+	OpSetCell:       {"OpSetCell", []int{1}},
+	OpLoadCell:      {"OpLoadCell", []int{1}},
+	OpResetLocal:    {"OpResetLocal", []int{1}},
+	OpGetFree:       {"OpGetFree", []int{1}},
+	OpSetFree:       {"OpSetFree", []int{1}},
+	OpLoadFree:      {"OpLoadFree", []int{1}},
+	OpGetBuiltin:    {"OpGetBuiltin", []int{1}},
+	OpArray:         {"OpArray", []int{2}},
+	OpHash:          {"OpHash", []int{2}},
+	OpIndex:         {"OpIndex", []int{}},
+	OpSetIndex:      {"OpSetIndex", []int{1}},
+	OpCall:          {"OpCall", []int{1}},
+	OpReturnValue:   {"OpReturnValue", []int{}},
+	OpReturn:        {"OpReturn", []int{}},
+	OpClosure:       {"OpClosure", []int{2, 1}}, // constant index, number of free variables
+	OpIter:          {"OpIter", []int{}},
+	OpIterNext:      {"OpIterNext", []int{2}},
+	OpThrow:         {"OpThrow", []int{}},
+	OpTry:           {"OpTry", []int{2}},
+	OpEndTry:        {"OpEndTry", []int{}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// MaxOperand is the largest value an operand of the given width in bytes holds
+func MaxOperand(width int) int {
+	return 1<<(8*uint(width)) - 1
+}
+
+// StackEffect is how many values an instruction takes off the stack and how
+// many it puts back. a jump counts as the path that does not jump.
+func StackEffect(op Opcode, operands []int) (pops, pushes int) {
+	switch op {
+	case OpConstant, OpTrue, OpFalse, OpNull,
+		OpGetGlobal, OpGetLocal, OpGetCell, OpLoadCell,
+		OpGetFree, OpLoadFree, OpGetBuiltin:
+		return 0, 1
+	case OpPop, OpJumpNotTruthy, OpSetGlobal, OpSetLocal,
+		OpSetCell, OpSetFree, OpReturnValue, OpThrow:
+		return 1, 0
+	case OpMinus, OpBang, OpIter, OpIterNext:
+		return 1, 1
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpPow,
+		OpEqual, OpNotEqual, OpLessThan, OpLessEqual,
+		OpGreaterThan, OpGreaterEqual, OpIndex:
+		return 2, 1
+	case OpSetIndex:
+		return 3, 1
+	case OpArray, OpHash:
+		return operands[0], 1
+	case OpCall:
+		return operands[0] + 1, 1
+	case OpClosure:
+		return operands[1], 1
+	}
+	return 0, 0
+}
+
+// Make encodes an instruction. it returns nothing for an unknown opcode.
+// operands larger than MaxOperand of their width are cut off, so the caller
+// has to check them first.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+	return instruction
+}
+
+// ReadOperands decodes the operands following an opcode, and returns how
+// many bytes they took
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
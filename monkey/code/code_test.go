@@ -0,0 +1,155 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Errorf("instruction has wrong length. want=%d, got=%d",
+				len(tt.expected), len(instruction))
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != tt.expected[i] {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d",
+					i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+			expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestEveryOpcodeIsDefined(t *testing.T) {
+	for op := OpConstant; op <= OpEndTry; op++ {
+		if _, err := Lookup(byte(op)); err != nil {
+			t.Errorf("opcode %d has no definition", op)
+		}
+	}
+}
+
+func TestStackEffect(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		pops     int
+		pushes   int
+	}{
+		{OpConstant, []int{0}, 0, 1},
+		{OpPop, []int{}, 1, 0},
+		{OpAdd, []int{}, 2, 1},
+		{OpBang, []int{}, 1, 1},
+		{OpSetIndex, []int{0}, 3, 1},
+		{OpArray, []int{3}, 3, 1},
+		{OpCall, []int{2}, 3, 1},
+		{OpClosure, []int{0, 2}, 2, 1},
+		{OpIterNext, []int{0}, 1, 1},
+		{OpEndTry, []int{}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		pops, pushes := StackEffect(tt.op, tt.operands)
+		if pops != tt.pops || pushes != tt.pushes {
+			t.Errorf("wrong stack effect for opcode %d. want=(%d, %d), got=(%d, %d)",
+				tt.op, tt.pops, tt.pushes, pops, pushes)
+		}
+	}
+}
+
+func TestLineTableLookup(t *testing.T) {
+	lines := LineTable{
+		{Offset: 0, Pos: token.Position{Line: 1, Column: 1}},
+		{Offset: 4, Pos: token.Position{Line: 2, Column: 3}},
+	}
+	tests := []struct {
+		offset   int
+		expected int
+	}{
+		{0, 1},
+		{3, 1},
+		{4, 2},
+		{100, 2},
+	}
+	for _, tt := range tests {
+		if pos := lines.Lookup(tt.offset); pos.Line != tt.expected {
+			t.Errorf("wrong line for offset %d. want=%d, got=%d", tt.offset, tt.expected, pos.Line)
+		}
+	}
+	if pos := (LineTable{}).Lookup(0); pos.IsValid() {
+		t.Errorf("empty table gave a position: %s", pos)
+	}
+}
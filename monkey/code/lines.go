@@ -0,0 +1,27 @@
+package code
+
+import (
+	"sort"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+// LineTable maps instructions back to where they came from in the source,
+// for error positions and the disassembler. an entry covers the instructions
+// from its offset up to the offset of the next entry.
+type LineTable []LineEntry
+
+type LineEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// Lookup gives the position of the instruction at offset, or the zero
+// position when the table does not cover it
+func (lt LineTable) Lookup(offset int) token.Position {
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return lt[i-1].Pos
+}
@@ -0,0 +1,1007 @@
+// Package compiler turns the AST into bytecode for the vm. it keeps the
+// semantics of the evaluator, so both backends give the same results.
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/ast"
+	"github.com/fandan-nyc/all-interpretors/monkey/code"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+// the local and free operands are a single byte
+const maxLocals = 256
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	pos token.Position // of the innermost node being compiled
+	err error          // the first operand that did not fit, see checkOperands
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope is the function being compiled
+type CompilationScope struct {
+	instructions        code.Instructions
+	lines               code.LineTable
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+
+	// depth is how many values the code emitted so far leaves on the stack.
+	// break and continue need it to drop what the loop body has pushed.
+	depth int
+
+	controls []*control // the loops and try blocks around the current code
+}
+
+// control is a loop or a try block that break, continue or return has to
+// leave properly
+type control struct {
+	loop      bool
+	depth     int
+	firstSlot int   // the loop body uses the local slots from here on
+	breaks    []int // jumps to patch once the end of the loop is known
+	continues []int
+
+	finally       *ast.BlockStatement
+	handlerActive bool // an OpTry of this block has not been ended yet
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Lines        code.LineTable
+	Constants    []object.Object
+
+	// the top level has local slots for the blocks outside any function
+	NumLocals  int
+	LocalNames []string
+
+	GlobalNames []string // for the error about a global that is not set
+}
+
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// NewWithState keeps compiling on top of an earlier compilation, so the REPL
+// can compile one line at a time against the same globals
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// SymbolTable is the global table, to pass to NewWithState
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	if err := c.compile(node); err != nil {
+		return err
+	}
+	return c.err
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	// an instruction gets the position of the node it was emitted for, which
+	// is where the evaluator reports an error in that node too
+	if pos := node.Pos(); pos.IsValid() {
+		outer := c.pos
+		c.pos = pos
+		defer func() { c.pos = outer }()
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+		// like in the evaluator, a program that ends in a let or a loop has
+		// no value, rather than the value of some earlier expression
+		if n := len(node.Statements); n > 0 {
+			switch last := node.Statements[n-1].(type) {
+			case *ast.ExpressionStatement, *ast.ReturnStatement:
+			default:
+				c.pos = last.Pos()
+				c.emit(code.OpNull)
+				c.emit(code.OpPop)
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		return c.compileLetStatement(node)
+
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			c.emit(code.OpNull)
+		} else if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.leaveControls(0); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+
+	case *ast.BreakStatement:
+		return c.compileLoopJump(true)
+
+	case *ast.ContinueStatement:
+		return c.compileLoopJump(false)
+
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		return c.compileInfixExpression(node)
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
+	case *ast.Identifier:
+		c.loadSymbol(c.resolve(node.Value))
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		// the pairs stay in source order, the hash keeps insertion order
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+	return nil
+}
+
+// a function literal is bound before its body is compiled, so the function
+// can call itself. any other value is compiled first, so let x = x + 1
+// still sees the outer x.
+func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
+	if c.symbolTable.HasConst(node.Name.Value) {
+		c.compileThrowMessage(fmt.Sprintf("cannot redeclare constant %s", node.Name.Value))
+		c.emit(code.OpPop)
+		return nil
+	}
+	var symbol Symbol
+	_, isFunction := node.Value.(*ast.FunctionLiteral)
+	if isFunction {
+		symbol = c.defineLet(node)
+	}
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+	if !isFunction {
+		symbol = c.defineLet(node)
+	}
+	if symbol.Scope == LocalScope && symbol.Index >= maxLocals {
+		return fmt.Errorf("too many local variables")
+	}
+	c.storeSymbol(symbol)
+	return nil
+}
+
+func (c *Compiler) defineLet(node *ast.LetStatement) Symbol {
+	if node.Token.Type == token.CONST {
+		return c.symbolTable.DefineConst(node.Name.Value)
+	}
+	return c.symbolTable.Define(node.Name.Value)
+}
+
+// resolve never fails: a name that is not defined anywhere yet becomes a
+// global, which the vm reports as not found if it is still unset when read.
+// a global defined later, like a function called before its let, then works.
+func (c *Compiler) resolve(name string) Symbol {
+	if symbol, ok := c.symbolTable.Resolve(name); ok {
+		return symbol
+	}
+	global := c.symbolTable
+	for global.Outer != nil {
+		global = global.Outer
+	}
+	return global.Define(name)
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"**": code.OpPow,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	"<=": code.OpLessEqual,
+	">":  code.OpGreaterThan,
+	">=": code.OpGreaterEqual,
+}
+
+// && and || only evaluate the right side when they need it, and always
+// give a boolean
+func (c *Compiler) compileInfixExpression(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	switch node.Operator {
+	case "&&":
+		jumpFalse := c.emit(code.OpJumpNotTruthy, 9999)
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(code.OpBang)
+		c.emit(code.OpBang)
+		jumpEnd := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpFalse, len(c.currentInstructions()))
+		c.scopes[c.scopeIndex].depth--
+		c.emit(code.OpFalse)
+		c.changeOperand(jumpEnd, len(c.currentInstructions()))
+		return nil
+	case "||":
+		jumpRight := c.emit(code.OpJumpNotTruthy, 9999)
+		c.emit(code.OpTrue)
+		jumpEnd := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpRight, len(c.currentInstructions()))
+		c.scopes[c.scopeIndex].depth--
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(code.OpBang)
+		c.emit(code.OpBang)
+		c.changeOperand(jumpEnd, len(c.currentInstructions()))
+		return nil
+	}
+
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	op, ok := infixOpcodes[node.Operator]
+	if !ok {
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+	c.emit(op)
+	return nil
+}
+
+var assignOpcodes = map[string]code.Opcode{
+	"+=": code.OpAdd,
+	"-=": code.OpSub,
+}
+
+// an assignment leaves the new value on the stack, as it is an expression
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	op, compound := assignOpcodes[node.Operator]
+	if !compound && node.Operator != "=" {
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol := c.resolve(target.Value)
+		switch {
+		case symbol.Scope == BuiltinScope:
+			c.compileThrowMessage("identifier not found: " + target.Value)
+			return nil
+		case symbol.Const:
+			c.compileThrowMessage(fmt.Sprintf("cannot assign to constant %s", target.Value))
+			return nil
+		}
+
+		if compound {
+			c.loadSymbol(symbol)
+		} else if symbol.Scope == GlobalScope {
+			// only to fail if the global is not set
+			c.loadSymbol(symbol)
+			c.emit(code.OpPop)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(op)
+		}
+		c.storeSymbol(symbol)
+		c.loadSymbol(symbol)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex, int(op))
+
+	default:
+		return fmt.Errorf("cannot assign to %s", node.Target.String())
+	}
+	return nil
+}
+
+// compileThrowMessage is for errors the compiler already knows the code
+// will run into. the expression still has to leave a value on the stack,
+// even though it is never reached.
+func (c *Compiler) compileThrowMessage(message string) {
+	c.emit(code.OpConstant, c.addConstant(&object.String{Value: message}))
+	c.emit(code.OpThrow)
+	c.emit(code.OpNull)
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+	jump := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+	c.scopes[c.scopeIndex].depth--
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alternative); err != nil {
+		return err
+	}
+	c.changeOperand(jump, len(c.currentInstructions()))
+	return nil
+}
+
+// compileBlockValue compiles a block that is used as a value: it leaves the
+// value of its last expression on the stack, or null
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+	if endsWithExpression(block) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+func endsWithExpression(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+// every iteration gets its own variables, like the evaluator gives every
+// iteration a new environment. only a variable captured by a closure can
+// tell, so only those are reset when an iteration ends.
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	loop := c.enterLoop()
+	loopStart := len(c.currentInstructions())
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	exit := c.emit(code.OpJumpNotTruthy, 9999)
+
+	c.enterBlock()
+	c.declareLater(node.Body)
+	err := c.Compile(node.Body)
+	c.leaveBlock()
+	if err != nil {
+		return err
+	}
+	return c.leaveLoop(loop, loopStart, []int{exit})
+}
+
+// the iterator lives in a hidden local, so nothing stays on the stack while
+// the body runs
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+	iterator := c.symbolTable.DefineHidden()
+	c.storeSymbol(iterator)
+
+	loop := c.enterLoop()
+	loopStart := len(c.currentInstructions())
+	c.loadSymbol(iterator)
+	exit := c.emit(code.OpIterNext, 9999)
+
+	c.enterBlock()
+	c.declareLater(node.Body)
+	variable := c.symbolTable.Define(node.Variable.Value)
+	c.storeSymbol(variable)
+	err := c.Compile(node.Body)
+	c.leaveBlock()
+	if err != nil {
+		return err
+	}
+	if c.symbolTable.NumLocals() > maxLocals {
+		return fmt.Errorf("too many local variables")
+	}
+	return c.leaveLoop(loop, loopStart, []int{exit})
+}
+
+func (c *Compiler) enterLoop() *control {
+	loop := &control{
+		loop:      true,
+		depth:     c.scopes[c.scopeIndex].depth,
+		firstSlot: c.symbolTable.NumLocals(),
+	}
+	c.pushControl(loop)
+	return loop
+}
+
+// leaveLoop ends the body: continue jumps to the reset of the captured
+// variables and back to loopStart, break and exits to the reset after it
+func (c *Compiler) leaveLoop(loop *control, loopStart int, exits []int) error {
+	c.popControl()
+
+	continueTarget := len(c.currentInstructions())
+	c.emitResets(loop.firstSlot)
+	c.emit(code.OpJump, loopStart)
+
+	end := len(c.currentInstructions())
+	c.emitResets(loop.firstSlot)
+	for _, pos := range loop.continues {
+		c.changeOperand(pos, continueTarget)
+	}
+	for _, pos := range append(exits, loop.breaks...) {
+		c.changeOperand(pos, end)
+	}
+	c.scopes[c.scopeIndex].depth = loop.depth
+	return nil
+}
+
+func (c *Compiler) emitResets(firstSlot int) {
+	function := c.symbolTable.function()
+	for slot := firstSlot; slot < len(function.localNames); slot++ {
+		if function.captured[slot] {
+			c.emit(code.OpResetLocal, slot)
+		}
+	}
+}
+
+// compileLoopJump is break or continue. on the way out it ends the try
+// blocks it leaves, runs their finally blocks and drops what the body has
+// left on the stack.
+func (c *Compiler) compileLoopJump(isBreak bool) error {
+	controls := c.scopes[c.scopeIndex].controls
+	i := len(controls) - 1
+	for i >= 0 && !controls[i].loop {
+		i--
+	}
+	if i < 0 {
+		return fmt.Errorf("break or continue outside a loop")
+	}
+	loop := controls[i]
+	if err := c.leaveControls(i + 1); err != nil {
+		return err
+	}
+
+	depth := c.scopes[c.scopeIndex].depth
+	for d := depth; d > loop.depth; d-- {
+		c.emit(code.OpPop)
+	}
+	pos := c.emit(code.OpJump, 9999)
+	if isBreak {
+		loop.breaks = append(loop.breaks, pos)
+	} else {
+		loop.continues = append(loop.continues, pos)
+	}
+	// the code after the jump is not reached, but it is compiled as if it were
+	c.scopes[c.scopeIndex].depth = depth
+	return nil
+}
+
+// leaveControls emits what leaving the try blocks from controls[from] on
+// needs, innermost first. each finally block is compiled as if it was
+// outside its own try.
+func (c *Compiler) leaveControls(from int) error {
+	controls := c.scopes[c.scopeIndex].controls
+	defer func() { c.scopes[c.scopeIndex].controls = controls }()
+
+	for i := len(controls) - 1; i >= from; i-- {
+		ctl := controls[i]
+		if ctl.loop {
+			continue
+		}
+		if ctl.handlerActive {
+			c.emit(code.OpEndTry)
+		}
+		if ctl.finally != nil {
+			c.scopes[c.scopeIndex].controls = controls[:i]
+			if err := c.compileFinally(ctl.finally); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileFinally(block *ast.BlockStatement) error {
+	if err := c.compileBlockValue(block); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	return nil
+}
+
+// try compiles to
+//
+//	OpTry catch; <try block>; OpEndTry; <finally>; OpJump end
+//	catch: OpTry rethrow; <bind the error>; <catch block>; OpEndTry; <finally>; OpJump end
+//	rethrow: <finally>; OpThrow
+//	end:
+//
+// without a finally the catch needs no handler of its own. without a catch
+// the handler runs the finally block and throws the error again.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	depth := c.scopes[c.scopeIndex].depth
+	ctl := &control{finally: node.Finally, handlerActive: true}
+	c.pushControl(ctl)
+
+	tryPos := c.emit(code.OpTry, 9999)
+	if err := c.compileBlockValue(node.Block); err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+	ctl.handlerActive = false
+	c.popControl()
+	if err := c.compileOptionalFinally(node.Finally); err != nil {
+		return err
+	}
+	jumps := []int{c.emit(code.OpJump, 9999)}
+
+	// the vm enters the handler with the error on the stack
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	c.scopes[c.scopeIndex].depth = depth + 1
+
+	if node.Catch != nil {
+		rethrowPos := -1
+		if node.Finally != nil {
+			rethrowPos = c.emit(code.OpTry, 9999)
+			ctl.handlerActive = true
+			c.pushControl(ctl)
+		}
+
+		c.enterBlock()
+		c.declareLater(node.Catch)
+		param := c.symbolTable.Define(node.Param.Value)
+		c.storeSymbol(param)
+		err := c.compileBlockValue(node.Catch)
+		c.leaveBlock()
+		if err != nil {
+			return err
+		}
+		if c.symbolTable.NumLocals() > maxLocals {
+			return fmt.Errorf("too many local variables")
+		}
+
+		if rethrowPos < 0 {
+			jumps = append(jumps, c.emit(code.OpJump, 9999))
+		} else {
+			c.emit(code.OpEndTry)
+			ctl.handlerActive = false
+			c.popControl()
+			if err := c.compileFinally(node.Finally); err != nil {
+				return err
+			}
+			jumps = append(jumps, c.emit(code.OpJump, 9999))
+			c.changeOperand(rethrowPos, len(c.currentInstructions()))
+			c.scopes[c.scopeIndex].depth = depth + 1
+		}
+	}
+
+	if node.Catch == nil || node.Finally != nil {
+		if err := c.compileFinally(node.Finally); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	}
+
+	for _, pos := range jumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.scopes[c.scopeIndex].depth = depth + 1
+	return nil
+}
+
+func (c *Compiler) compileOptionalFinally(block *ast.BlockStatement) error {
+	if block == nil {
+		return nil
+	}
+	return c.compileFinally(block)
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	c.declareLater(node.Body)
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	if endsWithExpression(node.Body) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	table := c.symbolTable
+	numLocals := table.NumLocals()
+	if numLocals > maxLocals || len(table.FreeSymbols) > maxLocals {
+		return fmt.Errorf("too many local variables")
+	}
+	freeSymbols := table.FreeSymbols
+	lines := c.scopes[c.scopeIndex].lines
+	instructions := c.leaveScope()
+
+	// the closure gets the cells of the variables it refers to, so both
+	// sides see every assignment
+	for _, s := range freeSymbols {
+		if s.Scope == FreeScope {
+			c.emit(code.OpLoadFree, s.Index)
+		} else {
+			c.emit(code.OpLoadCell, s.Index)
+		}
+	}
+
+	freeNames := make([]string, len(freeSymbols))
+	for i, s := range freeSymbols {
+		freeNames[i] = s.Name
+	}
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		Lines:         lines,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          node.Name,
+		LocalNames:    table.localNames,
+		FreeNames:     freeNames,
+		Source:        object.FunctionSource(node.Parameters, node.Body),
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	return nil
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+	c.addLine(pos)
+	c.setLastInstruction(op, pos)
+	pops, pushes := code.StackEffect(op, operands)
+	c.scopes[c.scopeIndex].depth += pushes - pops
+	return pos
+}
+
+// checkOperands keeps an error for the first operand too large for its
+// width, which Compile then returns. emit goes on, as the bytecode is not
+// used anyway.
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.err != nil {
+		return
+	}
+	for i, operand := range operands {
+		if max := code.MaxOperand(def.OperandWidths[i]); operand > max {
+			c.err = operandError(op, i, operand, max)
+			return
+		}
+	}
+}
+
+func operandError(op code.Opcode, i, operand, max int) error {
+	switch {
+	case op == code.OpConstant || op == code.OpClosure && i == 0:
+		return fmt.Errorf("too many constants: %d, at most %d", operand+1, max+1)
+	case op == code.OpClosure:
+		return fmt.Errorf("too many free variables: %d, at most %d", operand, max)
+	case op == code.OpGetGlobal || op == code.OpSetGlobal:
+		return fmt.Errorf("too many global variables: %d, at most %d", operand+1, max+1)
+	case op == code.OpJump || op == code.OpJumpNotTruthy || op == code.OpIterNext || op == code.OpTry:
+		return fmt.Errorf("function too large: jump to %d, at most %d", operand, max)
+	case op == code.OpArray:
+		return fmt.Errorf("too many elements in array literal: %d, at most %d", operand, max)
+	case op == code.OpHash:
+		return fmt.Errorf("too many pairs in hash literal: %d, at most %d", operand/2, max/2)
+	case op == code.OpCall:
+		return fmt.Errorf("too many arguments: %d, at most %d", operand, max)
+	}
+	def, _ := code.Lookup(byte(op))
+	return fmt.Errorf("operand %d of %s too large: %d, at most %d", i, def.Name, operand, max)
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) addLine(offset int) {
+	scope := &c.scopes[c.scopeIndex]
+	if n := len(scope.lines); n > 0 && scope.lines[n-1].Pos == c.pos {
+		return
+	}
+	scope.lines = append(scope.lines, code.LineEntry{Offset: offset, Pos: c.pos})
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+	lines := c.scopes[c.scopeIndex].lines
+	for len(lines) > 0 && lines[len(lines)-1].Offset >= last.Position {
+		lines = lines[:len(lines)-1]
+	}
+	c.scopes[c.scopeIndex].lines = lines
+	c.scopes[c.scopeIndex].depth++
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, []int{operand})
+	newInstruction := code.Make(op, operand)
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) pushControl(ctl *control) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.controls = append(scope.controls, ctl)
+}
+
+func (c *Compiler) popControl() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.controls = scope.controls[:len(scope.controls)-1]
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// leaveScope also turns the locals that closures captured into cells,
+// which is only known once the whole function is compiled
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+	patchCells(instructions, c.symbolTable.captured)
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return instructions
+}
+
+// declareLater lets the closures in block refer to the lets after them
+func (c *Compiler) declareLater(block *ast.BlockStatement) {
+	for _, s := range block.Statements {
+		if let, ok := s.(*ast.LetStatement); ok {
+			c.symbolTable.DeclareLater(let.Name.Value, let.Token.Type == token.CONST)
+		}
+	}
+}
+
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveBlock() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
+func patchCells(ins code.Instructions, captured map[int]bool) {
+	if len(captured) == 0 {
+		return
+	}
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		switch code.Opcode(ins[i]) {
+		case code.OpGetLocal:
+			if captured[operands[0]] {
+				ins[i] = byte(code.OpGetCell)
+			}
+		case code.OpSetLocal:
+			if captured[operands[0]] {
+				ins[i] = byte(code.OpSetCell)
+			}
+		}
+		i += 1 + read
+	}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	patchCells(c.currentInstructions(), c.symbolTable.captured)
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Lines:        c.scopes[c.scopeIndex].lines,
+		Constants:    c.constants,
+		NumLocals:    c.symbolTable.NumLocals(),
+		LocalNames:   c.symbolTable.localNames,
+		GlobalNames:  c.symbolTable.globalNames,
+	}
+}
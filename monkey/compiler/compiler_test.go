@@ -0,0 +1,871 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/ast"
+	"github.com/fandan-nyc/all-interpretors/monkey/code"
+	"github.com/fandan-nyc/all-interpretors/monkey/lexer"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+	"github.com/fandan-nyc/all-interpretors/monkey/parser"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1; 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "2 ** 3 % 2",
+			expectedConstants: []interface{}{2, 3, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPow),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 >= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "!true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpBang),
+				// 0006
+				code.Make(code.OpBang),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpFalse),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "false || true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpFalse),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpTrue),
+				// 0005
+				code.Make(code.OpJump, 11),
+				// 0008
+				code.Make(code.OpTrue),
+				// 0009
+				code.Make(code.OpBang),
+				// 0010
+				code.Make(code.OpBang),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { 10 } else { let a = 20; };",
+			expectedConstants: []interface{}{10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 17),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpSetGlobal, 0),
+				// 0016
+				code.Make(code.OpNull),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; let two = 2; one;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a name used before its let is the same global
+			input:             "let f = fn() { g }; let g = 1;",
+			expectedConstants: []interface{}{[]code.Instructions{code.Make(code.OpGetGlobal, 1), code.Make(code.OpReturnValue)}, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1; x = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; x += 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "const x = 1; x = 2;",
+			expectedConstants: []interface{}{1, "cannot assign to constant x"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpThrow),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let a = [1]; a[0] -= 1;",
+			expectedConstants: []interface{}{1, 0, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex, int(code.OpSub)),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCollections(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `["a", 2][1]`,
+			expectedConstants: []interface{}{"a", 2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{2: 3, 1: 4}",
+			expectedConstants: []interface{}{2, 3, 1, 4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn() { return 5 + 10 }",
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { return; }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpNull),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { let num = 55; num + a }(1)",
+			expectedConstants: []interface{}{
+				55,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "len([])",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpLoadCell, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the captured local becomes a cell everywhere in its function
+			input: "fn() { let a = 1; let f = fn() { a = 2 }; a }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetCell, 0),
+					code.Make(code.OpLoadCell, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetCell, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a function refers to itself through its own cell
+			input: "fn() { let f = fn() { f() }; f }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpLoadCell, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpSetCell, 0),
+					code.Make(code.OpGetCell, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "while (true) { break; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpJump, 10),
+				// 0007
+				code.Make(code.OpJump, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// break drops the 1 that is already on the stack
+			input:             "while (true) { 1 + if (true) { break; }; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 25),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpTrue),
+				// 0008
+				code.Make(code.OpJumpNotTruthy, 19),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpJump, 25),
+				// 0015
+				code.Make(code.OpNull),
+				// 0016
+				code.Make(code.OpJump, 20),
+				// 0019
+				code.Make(code.OpNull),
+				// 0020
+				code.Make(code.OpAdd),
+				// 0021
+				code.Make(code.OpPop),
+				// 0022
+				code.Make(code.OpJump, 0),
+				// 0025
+				code.Make(code.OpNull),
+				// 0026
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "for (x in [1]) { x }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIter),
+				// 0007
+				code.Make(code.OpSetLocal, 0),
+				// 0009
+				code.Make(code.OpGetLocal, 0),
+				// 0011
+				code.Make(code.OpIterNext, 22),
+				// 0014
+				code.Make(code.OpSetLocal, 1),
+				// 0016
+				code.Make(code.OpGetLocal, 1),
+				// 0018
+				code.Make(code.OpPop),
+				// 0019
+				code.Make(code.OpJump, 9),
+				// 0022
+				code.Make(code.OpNull),
+				// 0023
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a closure keeps the variable of its own iteration
+			input: "for (x in []) { fn() { x } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpArray, 0),
+				// 0003
+				code.Make(code.OpIter),
+				// 0004
+				code.Make(code.OpSetLocal, 0),
+				// 0006
+				code.Make(code.OpGetLocal, 0),
+				// 0008
+				code.Make(code.OpIterNext, 25),
+				// 0011
+				code.Make(code.OpSetCell, 1),
+				// 0013
+				code.Make(code.OpLoadCell, 1),
+				// 0015
+				code.Make(code.OpClosure, 0, 1),
+				// 0019
+				code.Make(code.OpPop),
+				// 0020
+				code.Make(code.OpResetLocal, 1),
+				// 0022
+				code.Make(code.OpJump, 6),
+				// 0025
+				code.Make(code.OpResetLocal, 1),
+				// 0027
+				code.Make(code.OpNull),
+				// 0028
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "try { 1 } catch (e) { e }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 10),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpEndTry),
+				// 0007
+				code.Make(code.OpJump, 17),
+				// 0010
+				code.Make(code.OpSetLocal, 0),
+				// 0012
+				code.Make(code.OpGetLocal, 0),
+				// 0014
+				code.Make(code.OpJump, 17),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "try { 1 } finally { 2 }",
+			expectedConstants: []interface{}{1, 2, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 14),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpEndTry),
+				// 0007
+				code.Make(code.OpConstant, 1),
+				// 0010
+				code.Make(code.OpPop),
+				// 0011
+				code.Make(code.OpJump, 19),
+				// 0014
+				code.Make(code.OpConstant, 2),
+				// 0017
+				code.Make(code.OpPop),
+				// 0018
+				code.Make(code.OpThrow),
+				// 0019
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the return leaves the try block, so it runs the finally block first
+			input: "fn() { try { return 1 } finally { 2 } }",
+			expectedConstants: []interface{}{
+				1, 2, 2, 2,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTry, 21),
+					// 0003
+					code.Make(code.OpConstant, 0),
+					// 0006
+					code.Make(code.OpEndTry),
+					// 0007
+					code.Make(code.OpConstant, 1),
+					// 0010
+					code.Make(code.OpPop),
+					// 0011
+					code.Make(code.OpReturnValue),
+					// 0012
+					code.Make(code.OpNull),
+					// 0013
+					code.Make(code.OpEndTry),
+					// 0014
+					code.Make(code.OpConstant, 2),
+					// 0017
+					code.Make(code.OpPop),
+					// 0018
+					code.Make(code.OpJump, 26),
+					// 0021
+					code.Make(code.OpConstant, 3),
+					// 0024
+					code.Make(code.OpPop),
+					// 0025
+					code.Make(code.OpThrow),
+					// 0026
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 4, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStackDepthAfterCompiling(t *testing.T) {
+	inputs := []string{
+		"let a = [1, 2]; a[0] = 3; a",
+		"while (true) { let x = 1 + if (x) { continue } else { break }; }",
+		"for (c in \"ab\") { try { c } catch (e) { break } finally { 1 } }",
+		"fn(x) { x && 1 || 2 }",
+		"try { throw 1 } catch (e) { e } finally { 2 }",
+	}
+	for _, input := range inputs {
+		compiler := New()
+		if err := compiler.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		if depth := compiler.scopes[compiler.scopeIndex].depth; depth != 0 {
+			t.Errorf("stack depth after %q is %d, want 0", input, depth)
+		}
+	}
+}
+
+func TestOperandLimits(t *testing.T) {
+	repeat := func(s string, n int) string {
+		return strings.TrimSuffix(strings.Repeat(s, n), ", ")
+	}
+	full := func() *Compiler {
+		constants := make([]object.Object, code.MaxOperand(2)+1)
+		return NewWithState(NewSymbolTable(), constants)
+	}
+	manyGlobals := func() *Compiler {
+		symbolTable := NewSymbolTable()
+		for i := 0; i <= code.MaxOperand(2); i++ {
+			symbolTable.Define(fmt.Sprintf("g%d", i))
+		}
+		return NewWithState(symbolTable, []object.Object{})
+	}
+
+	tests := []struct {
+		compiler func() *Compiler
+		input    string
+		expected string
+	}{
+		{full, "1", "too many constants: 65537, at most 65536"},
+		{full, "fn() { 1 }", "too many constants: 65537, at most 65536"},
+		{manyGlobals, "let x = 1;", "too many global variables: 65537, at most 65536"},
+		{New, "if (true) { " + strings.Repeat("true; ", 33000) + "}", "function too large: jump to 66006, at most 65535"},
+		{New, "while (false) { " + strings.Repeat("true; ", 33000) + "}", "function too large: jump to 66007, at most 65535"},
+		{New, "[" + repeat("true, ", 65536) + "]", "too many elements in array literal: 65536, at most 65535"},
+		{New, "{" + repeat("true: true, ", 32768) + "}", "too many pairs in hash literal: 32768, at most 32767"},
+		{New, "len(" + repeat("true, ", 256) + ")", "too many arguments: 256, at most 255"},
+	}
+
+	for _, tt := range tests {
+		err := tt.compiler().Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected an error for %.40q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %.40q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+
+	// right at the limits it still compiles
+	for _, input := range []string{
+		"[" + repeat("true, ", 65535) + "]",
+		"len(" + repeat("true, ", 255) + ")",
+	} {
+		if err := New().Compile(parse(input)); err != nil {
+			t.Errorf("compiler error for %.40q: %s", input, err)
+		}
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("testInstructions failed for %q: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("testConstants failed for %q: %s", tt.input, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+	if concatted.String() != actual.String() {
+		return fmt.Errorf("wrong instructions.\nwant=\n%s\ngot=\n%s", concatted, actual)
+	}
+	return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d", len(actual), len(expected))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			err := testIntegerObject(int64(constant), actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testIntegerObject failed: %s", i, err)
+			}
+		case string:
+			err := testStringObject(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+			err := testInstructions(constant, fn.Instructions)
+			if err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+	return nil
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	}
+	return nil
+}
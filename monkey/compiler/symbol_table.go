@@ -0,0 +1,180 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Const bool
+}
+
+// SymbolTable maps names to where the VM keeps them. there is one table for
+// the globals and one per function. loop bodies and catch blocks get a
+// block table, which keeps its names to itself but puts them in the local
+// slots of the function around it. the top level has local slots too, for
+// the blocks that are not inside any function.
+type SymbolTable struct {
+	Outer *SymbolTable
+	block bool
+
+	store       map[string]Symbol
+	FreeSymbols []Symbol // the symbols of the enclosing function that the free ones refer to
+
+	// the names a let defines further down, and whether they are const. a
+	// closure that refers to one of them before the let gets the variable
+	// anyway, as the evaluator finds it in the environment by the time the
+	// closure runs. that is what makes local functions mutually recursive.
+	later map[string]bool
+
+	// only used in the global and function tables, never in a block
+	globalNames []string     // by index
+	localNames  []string     // by slot
+	captured    map[int]bool // local slots that a closure refers to
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		store:    make(map[string]Symbol),
+		later:    make(map[string]bool),
+		captured: make(map[int]bool),
+	}
+}
+
+// NewEnclosedSymbolTable is the table of a function defined where outer is in effect
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewBlockSymbolTable is the table of a block in the function of outer
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+// function is the table that owns the local slots
+func (s *SymbolTable) function() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
+
+func (s *SymbolTable) isGlobal() bool {
+	return s.Outer == nil && !s.block
+}
+
+func (s *SymbolTable) Define(name string) Symbol {
+	return s.define(name, false)
+}
+
+func (s *SymbolTable) DefineConst(name string) Symbol {
+	return s.define(name, true)
+}
+
+// defining a name again in the same table reuses its slot, like a second
+// let in the same environment replaces the binding. the compiler does not
+// do that for a const, see HasConst.
+func (s *SymbolTable) define(name string, isConst bool) Symbol {
+	scope := LocalScope
+	if s.isGlobal() {
+		scope = GlobalScope
+	}
+	if existing, ok := s.store[name]; ok && existing.Scope == scope {
+		existing.Const = isConst
+		s.store[name] = existing
+		return existing
+	}
+
+	symbol := Symbol{Name: name, Scope: scope, Const: isConst}
+	if scope == GlobalScope {
+		symbol.Index = len(s.globalNames)
+		s.globalNames = append(s.globalNames, name)
+	} else {
+		symbol.Index = s.function().newSlot(name)
+	}
+	s.store[name] = symbol
+	return symbol
+}
+
+// HasConst tells whether name is a const defined in this table itself, so
+// defining it here again would redeclare it
+func (s *SymbolTable) HasConst(name string) bool {
+	symbol, ok := s.store[name]
+	return ok && symbol.Const && symbol.Scope != FreeScope
+}
+
+// DefineHidden takes a local slot for the compiler itself, no name refers to it
+func (s *SymbolTable) DefineHidden() Symbol {
+	return Symbol{Scope: LocalScope, Index: s.function().newSlot("")}
+}
+
+func (s *SymbolTable) newSlot(name string) int {
+	s.localNames = append(s.localNames, name)
+	return len(s.localNames) - 1
+}
+
+// DeclareLater tells the table about a let that comes further down
+func (s *SymbolTable) DeclareLater(name string, isConst bool) {
+	s.later[name] = isConst
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope, Const: original.Const}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Resolve looks name up from the innermost scope out. a local of an
+// enclosing function becomes a free variable of this one, and is marked as
+// captured in the function it belongs to.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	return s.resolve(name, false)
+}
+
+// nested tells whether the name is used in a function inside this table
+func (s *SymbolTable) resolve(name string, nested bool) (Symbol, bool) {
+	if symbol, ok := s.store[name]; ok {
+		return symbol, true
+	}
+	if isConst, ok := s.later[name]; ok && nested && !s.isGlobal() {
+		return s.define(name, isConst), true
+	}
+	if s.Outer == nil {
+		return Symbol{}, false
+	}
+	if s.block {
+		return s.Outer.resolve(name, nested)
+	}
+
+	symbol, ok := s.Outer.resolve(name, true)
+	if !ok || symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+	if symbol.Scope == LocalScope {
+		s.Outer.function().captured[symbol.Index] = true
+	}
+	return s.function().defineFree(symbol), true
+}
+
+// NumLocals is the number of local slots a frame of this function needs
+func (s *SymbolTable) NumLocals() int {
+	return len(s.function().localNames)
+}
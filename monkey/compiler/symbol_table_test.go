@@ -0,0 +1,154 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	global := NewSymbolTable()
+	if a := global.Define("a"); a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("a wrong. got=%+v", a)
+	}
+	if b := global.DefineConst("b"); b != (Symbol{Name: "b", Scope: GlobalScope, Index: 1, Const: true}) {
+		t.Errorf("b wrong. got=%+v", b)
+	}
+	// a second let of the same name keeps the slot
+	if a := global.Define("a"); a.Index != 0 {
+		t.Errorf("a redefined to a new index. got=%+v", a)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	if c := local.Define("c"); c != (Symbol{Name: "c", Scope: LocalScope, Index: 0}) {
+		t.Errorf("c wrong. got=%+v", c)
+	}
+	if a := local.Define("a"); a != (Symbol{Name: "a", Scope: LocalScope, Index: 1}) {
+		t.Errorf("local a wrong. got=%+v", a)
+	}
+}
+
+func TestResolveLocalAndGlobal(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(3, "len")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("b")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "len", Scope: BuiltinScope, Index: 3},
+		{Name: "b", Scope: LocalScope, Index: 0},
+	}
+	for _, sym := range expected {
+		result, ok := local.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+	if len(local.FreeSymbols) != 0 {
+		t.Errorf("globals and builtins must not be free. got=%+v", local.FreeSymbols)
+	}
+	if _, ok := local.Resolve("c"); ok {
+		t.Errorf("c resolved, but is not defined")
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	first := NewEnclosedSymbolTable(global)
+	first.Define("b")
+	first.DefineConst("c")
+
+	second := NewEnclosedSymbolTable(first)
+	second.Define("d")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "b", Scope: FreeScope, Index: 0},
+		{Name: "c", Scope: FreeScope, Index: 1, Const: true},
+		{Name: "d", Scope: LocalScope, Index: 0},
+	}
+	for _, sym := range expected {
+		result, ok := second.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	expectedFree := []Symbol{
+		{Name: "b", Scope: LocalScope, Index: 0},
+		{Name: "c", Scope: LocalScope, Index: 1, Const: true},
+	}
+	if len(second.FreeSymbols) != len(expectedFree) {
+		t.Fatalf("wrong number of free symbols. got=%d", len(second.FreeSymbols))
+	}
+	for i, sym := range expectedFree {
+		if second.FreeSymbols[i] != sym {
+			t.Errorf("wrong free symbol. want=%+v, got=%+v", sym, second.FreeSymbols[i])
+		}
+	}
+	if !first.captured[0] || !first.captured[1] {
+		t.Errorf("captured locals not marked. got=%v", first.captured)
+	}
+}
+
+func TestBlockSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	// a block at the top level uses the local slots of the top level
+	block := NewBlockSymbolTable(global)
+	if x := block.Define("x"); x != (Symbol{Name: "x", Scope: LocalScope, Index: 0}) {
+		t.Errorf("x wrong. got=%+v", x)
+	}
+	if a, _ := block.Resolve("a"); a.Scope != GlobalScope {
+		t.Errorf("a wrong. got=%+v", a)
+	}
+
+	fn := NewEnclosedSymbolTable(global)
+	fn.Define("p")
+	inner := NewBlockSymbolTable(fn)
+	if p, _ := inner.Resolve("p"); p != (Symbol{Name: "p", Scope: LocalScope, Index: 0}) {
+		t.Errorf("p wrong. got=%+v", p)
+	}
+	// shadows p inside the block, in a slot of its own
+	if p := inner.Define("p"); p.Index != 1 {
+		t.Errorf("p in block wrong. got=%+v", p)
+	}
+	if fn.NumLocals() != 2 || inner.NumLocals() != 2 {
+		t.Errorf("block locals not counted in the function. got=%d", fn.NumLocals())
+	}
+	if _, ok := fn.store["p"]; !ok || fn.store["p"].Index != 0 {
+		t.Errorf("block changed the function's p. got=%+v", fn.store["p"])
+	}
+}
+
+func TestResolveDeclaredLater(t *testing.T) {
+	global := NewSymbolTable()
+	outer := NewEnclosedSymbolTable(global)
+	outer.Define("even")
+	outer.DeclareLater("odd", false)
+
+	// the outer function itself does not see odd before its let
+	if _, ok := outer.Resolve("odd"); ok {
+		t.Errorf("odd resolved in its own function before its let")
+	}
+
+	inner := NewEnclosedSymbolTable(outer)
+	odd, ok := inner.Resolve("odd")
+	if !ok || odd != (Symbol{Name: "odd", Scope: FreeScope, Index: 0}) {
+		t.Fatalf("odd wrong. got=%+v", odd)
+	}
+	// the let then gets the slot the closure already refers to
+	if let := outer.Define("odd"); let != (Symbol{Name: "odd", Scope: LocalScope, Index: 1}) || !outer.captured[1] {
+		t.Errorf("let odd wrong. got=%+v", let)
+	}
+}
@@ -0,0 +1,150 @@
+// Package disasm lists compiled bytecode in a readable form, to see what
+// the compiler made of a program.
+package disasm
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/code"
+	"github.com/fandan-nyc/all-interpretors/monkey/compiler"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+)
+
+// Disassemble lists the top level and then every function in the constant
+// pool. each instruction shows its offset, its operands and what they refer
+// to, and the source position it came from whenever that changes:
+//
+//	== <main> ==
+//	1:9    0000 OpConstant 0         ; 1
+//	1:1    0003 OpSetGlobal 0        ; x
+func Disassemble(bytecode *compiler.Bytecode) string {
+	var out bytes.Buffer
+	main := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Lines:        bytecode.Lines,
+		NumLocals:    bytecode.NumLocals,
+		LocalNames:   bytecode.LocalNames,
+	}
+	out.WriteString("== <main> ==\n")
+	writeLocals(&out, main)
+	writeInstructions(&out, main, bytecode)
+
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&out, "\n== %s (constant %d) ==\n", functionName(fn), i)
+		fmt.Fprintf(&out, "params: %d", fn.NumParameters)
+		if len(fn.FreeNames) > 0 {
+			fmt.Fprintf(&out, ", free: %s", strings.Join(fn.FreeNames, " "))
+		}
+		out.WriteString("\n")
+		writeLocals(&out, fn)
+		writeInstructions(&out, fn, bytecode)
+	}
+	return out.String()
+}
+
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
+
+func writeLocals(out *bytes.Buffer, fn *object.CompiledFunction) {
+	if fn.NumLocals == 0 {
+		return
+	}
+	names := make([]string, fn.NumLocals)
+	for i := range names {
+		names[i] = localName(fn, i)
+	}
+	fmt.Fprintf(out, "locals: %s\n", strings.Join(names, " "))
+}
+
+// the compiler's own locals have no name
+func localName(fn *object.CompiledFunction, slot int) string {
+	if slot < len(fn.LocalNames) && fn.LocalNames[slot] != "" {
+		return fn.LocalNames[slot]
+	}
+	return fmt.Sprintf("<%d>", slot)
+}
+
+func writeInstructions(out *bytes.Buffer, fn *object.CompiledFunction, bytecode *compiler.Bytecode) {
+	ins := fn.Instructions
+	lastPos := ""
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(out, "%04d ERROR: %s\n", i, err)
+			i++
+			continue
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		pos := ""
+		if p := fn.Lines.Lookup(i); p.IsValid() {
+			pos = fmt.Sprintf("%d:%d", p.Line, p.Column)
+		}
+		column := ""
+		if pos != lastPos {
+			column = pos
+			lastPos = pos
+		}
+
+		instruction := def.Name
+		for _, o := range operands {
+			instruction += " " + strconv.Itoa(o)
+		}
+		line := fmt.Sprintf("%-6s %04d %-20s", column, i, instruction)
+		if comment := describe(code.Opcode(ins[i]), operands, fn, bytecode); comment != "" {
+			line += " ; " + comment
+		}
+		out.WriteString(strings.TrimRight(line, " ") + "\n")
+		i += 1 + read
+	}
+}
+
+// describe tells what the operands of an instruction refer to
+func describe(op code.Opcode, operands []int, fn *object.CompiledFunction, bytecode *compiler.Bytecode) string {
+	switch op {
+	case code.OpConstant, code.OpClosure:
+		if operands[0] < len(bytecode.Constants) {
+			return inspect(bytecode.Constants[operands[0]])
+		}
+	case code.OpGetGlobal, code.OpSetGlobal:
+		if operands[0] < len(bytecode.GlobalNames) {
+			return bytecode.GlobalNames[operands[0]]
+		}
+	case code.OpGetLocal, code.OpSetLocal, code.OpGetCell, code.OpSetCell, code.OpLoadCell, code.OpResetLocal:
+		return localName(fn, operands[0])
+	case code.OpGetFree, code.OpSetFree, code.OpLoadFree:
+		if operands[0] < len(fn.FreeNames) {
+			return fn.FreeNames[operands[0]]
+		}
+	case code.OpGetBuiltin:
+		if operands[0] < len(object.Builtins) {
+			return object.Builtins[operands[0]].Name
+		}
+	case code.OpSetIndex:
+		if operands[0] != 0 {
+			if def, err := code.Lookup(byte(operands[0])); err == nil {
+				return def.Name
+			}
+		}
+	}
+	return ""
+}
+
+// strings are quoted, so "1" and 1 look different
+func inspect(obj object.Object) string {
+	if str, ok := obj.(*object.String); ok {
+		return strconv.Quote(str.Value)
+	}
+	return obj.Inspect()
+}
@@ -0,0 +1,73 @@
+package disasm
+
+import (
+	"testing"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/compiler"
+	"github.com/fandan-nyc/all-interpretors/monkey/lexer"
+	"github.com/fandan-nyc/all-interpretors/monkey/parser"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := `let x = "one";
+let add = fn(a) {
+  fn(b) { a + b + len(x) }
+};
+for (c in x) { add(1)(2) }`
+
+	expected := `== <main> ==
+locals: <0> c
+1:9    0000 OpConstant 0         ; "one"
+1:1    0003 OpSetGlobal 0        ; x
+2:11   0006 OpClosure 2 0        ; CompiledFunction[add]
+2:1    0010 OpSetGlobal 1        ; add
+5:11   0013 OpGetGlobal 0        ; x
+5:1    0016 OpIter
+       0017 OpSetLocal 0         ; <0>
+       0019 OpGetLocal 0         ; <0>
+       0021 OpIterNext 43
+       0024 OpSetLocal 1         ; c
+5:16   0026 OpGetGlobal 1        ; add
+5:20   0029 OpConstant 3         ; 1
+5:16   0032 OpCall 1
+5:23   0034 OpConstant 4         ; 2
+5:16   0037 OpCall 1
+       0039 OpPop
+5:1    0040 OpJump 19
+       0043 OpNull
+       0044 OpPop
+
+== <anonymous> (constant 1) ==
+params: 1, free: a
+locals: b
+3:11   0000 OpGetFree 0          ; a
+3:15   0002 OpGetLocal 0         ; b
+3:11   0004 OpAdd
+3:19   0005 OpGetBuiltin 0       ; len
+3:23   0007 OpGetGlobal 0        ; x
+3:19   0010 OpCall 1
+3:11   0012 OpAdd
+       0013 OpReturnValue
+
+== add (constant 2) ==
+params: 1
+locals: a
+3:3    0000 OpLoadCell 0         ; a
+       0002 OpClosure 1 1        ; CompiledFunction[<anonymous>]
+       0006 OpReturnValue
+`
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors: %v", p.Errors())
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	if got := Disassemble(comp.Bytecode()); got != expected {
+		t.Errorf("wrong listing.\nwant=\n%s\ngot=\n%s", expected, got)
+	}
+}
@@ -0,0 +1,457 @@
+package evaluator
+
+import (
+	"github.com/fandan-nyc/all-interpretors/monkey/ast"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
+)
+
+// Eval evaluates node. an error that does not know where it happened yet
+// gets the position of node, so it ends up with the innermost failing node.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := eval(node, env)
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	// statements
+	case *ast.Program:
+		return evalProgram(node, env)
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			return &object.ReturnValue{Value: NULL}
+		}
+		val := Eval(node.ReturnValue, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	case *ast.LetStatement:
+		if env.HasConst(node.Name.Value) {
+			return object.NewError("cannot redeclare constant %s", node.Name.Value)
+		}
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if node.Token.Type == token.CONST {
+			env.SetConst(node.Name.Value, val)
+		} else {
+			env.Set(node.Name.Value, val)
+		}
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.ThrowStatement:
+		return evalThrowStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
+
+	// expressions
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.Boolean:
+		return object.NativeBoolToBooleanObject(node.Value)
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
+		}
+		return object.PrefixOperation(node.Operator, right)
+	case *ast.InfixExpression:
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, left, env)
+		}
+		right := Eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
+		}
+		return object.InfixOperation(node.Operator, left, right)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+	case *ast.FunctionLiteral:
+		return &object.Function{Name: node.Name, Parameters: node.Parameters, Body: node.Body, Env: env}
+	case *ast.CallExpression:
+		function := Eval(node.Function, env)
+		if isAbrupt(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isAbrupt(args[0]) {
+			return args[0]
+		}
+		return applyFunction(function, args, node.Pos())
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+		return object.Index(left, index)
+	}
+	return nil
+}
+
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+	for _, statement := range program.Statements {
+		result = Eval(statement, env)
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+	return result
+}
+
+// unlike evalProgram, a block does not unwrap the return value, so a return
+// inside nested blocks still stops the outer function. break and continue
+// travel up to the enclosing loop the same way.
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+	for _, statement := range block.Statements {
+		result = Eval(statement, env)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
+				return result
+			}
+		}
+	}
+	// a block is used as a value (if, function body), so an empty block or
+	// one ending in a let still has to produce something
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// && and || only evaluate the right side when the left side does not decide
+// the result already. the result is always a boolean.
+func evalLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Environment) object.Object {
+	if node.Operator == "&&" && !object.IsTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && object.IsTruthy(left) {
+		return TRUE
+	}
+	right := Eval(node.Right, env)
+	if isAbrupt(right) {
+		return right
+	}
+	return object.NativeBoolToBooleanObject(object.IsTruthy(right))
+}
+
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		return evalIdentifierAssignment(node, target, env)
+	case *ast.IndexExpression:
+		return evalIndexAssignment(node, target, env)
+	default:
+		return object.NewError("cannot assign to %s", node.Target.String())
+	}
+}
+
+// x = y assigns to x wherever it was defined, so a closure can change a
+// variable of the function that created it
+func evalIdentifierAssignment(node *ast.AssignExpression, ident *ast.Identifier, env *object.Environment) object.Object {
+	current, ok := env.Get(ident.Value)
+	if !ok {
+		return object.NewError("identifier not found: " + ident.Value)
+	}
+	if env.IsConst(ident.Value) {
+		return object.NewError("cannot assign to constant %s", ident.Value)
+	}
+	value := Eval(node.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+	result := applyAssignOperator(node.Operator, current, value)
+	if isAbrupt(result) {
+		return result
+	}
+	env.Assign(ident.Value, result)
+	return result
+}
+
+// arr[i] = x and h[k] = x change the array or hash in place, so every
+// binding that refers to it sees the change
+func evalIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression, env *object.Environment) object.Object {
+	left := Eval(target.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+	index := Eval(target.Index, env)
+	if isAbrupt(index) {
+		return index
+	}
+	value := Eval(node.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+
+	return object.SetIndex(left, index, value, assignOperation(node.Operator))
+}
+
+// applyAssignOperator gives the new value of the target: x += y is x + y
+func applyAssignOperator(operator string, current, value object.Object) object.Object {
+	if operator == "=" {
+		return value
+	}
+	return object.InfixOperation(assignOperation(operator), current, value)
+}
+
+// assignOperation is the operator without the trailing =, empty for a plain
+// assignment
+func assignOperation(operator string) string {
+	return operator[:len(operator)-1]
+}
+
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := Eval(ie.Condition, env)
+	if isAbrupt(condition) {
+		return condition
+	}
+	if object.IsTruthy(condition) {
+		return Eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return Eval(ie.Alternative, env)
+	}
+	return NULL
+}
+
+// loops are statements, they produce no value. every iteration runs the body
+// in a new environment, so a let inside the body does not leak out of the
+// loop and a closure made in the body keeps the loop variable of its own
+// iteration.
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !object.IsTruthy(condition) {
+			return nil
+		}
+		result := Eval(ws.Body, object.NewEnclosedEnvironment(env))
+		if stop, value := loopControl(result); stop {
+			return value
+		}
+	}
+}
+
+// for (x in iterable) goes over the elements of an array, the keys of a
+// hash or the characters of a string
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+	items, err := object.IterationItems(iterable)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		loopEnv := object.NewEnclosedEnvironment(env)
+		loopEnv.Set(fs.Variable.Value, item)
+		result := Eval(fs.Body, loopEnv)
+		if stop, value := loopControl(result); stop {
+			return value
+		}
+	}
+	return nil
+}
+
+// loopControl tells a loop what to do with the result of its body: stop
+// on break, and stop and pass on a return value or an error
+func loopControl(result object.Object) (bool, object.Object) {
+	switch result.(type) {
+	case *object.Break:
+		return true, nil
+	case *object.ReturnValue, *object.Error:
+		return true, result
+	}
+	return false, nil
+}
+
+// throw turns any value into an error. throwing a caught error again keeps
+// where it first happened and the calls it already unwound through.
+func evalThrowStatement(ts *ast.ThrowStatement, env *object.Environment) object.Object {
+	val := Eval(ts.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+	return object.ThrownError(val)
+}
+
+// the finally block always runs last. it only changes the result when it
+// fails, returns or breaks itself.
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Block, env)
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(te.Param.Value, &object.Exception{Error: err})
+		result = Eval(te.Catch, catchEnv)
+	}
+	if te.Finally != nil {
+		finally := Eval(te.Finally, env)
+		switch finally.(type) {
+		case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+			return finally
+		}
+	}
+	return result
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	// builtins are looked up after the environment, so a let can shadow them
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
+		return builtin
+	}
+	return object.NewError("identifier not found: " + node.Value)
+}
+
+// the pairs are evaluated in source order. a key written twice keeps its
+// first position and its last value.
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isAbrupt(key) {
+			return key
+		}
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return object.NewError("unusable as hash key: %s", key.Type())
+		}
+		value := Eval(pair.Value, env)
+		if isAbrupt(value) {
+			return value
+		}
+		hash.Set(hashKey, value)
+	}
+	return hash
+}
+
+// evalExpressions evaluates left to right and stops at the first error, or
+// return, break or continue, which is then returned as the only element
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isAbrupt(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+	return result
+}
+
+// applyFunction calls fn from callSite. an error coming out of the function
+// body records the call, so the error ends up with the whole call stack.
+func applyFunction(fn object.Object, args []object.Object, callSite token.Position) object.Object {
+	if builtin, ok := fn.(*object.Builtin); ok {
+		return builtin.Fn(args...)
+	}
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return object.NewError("not a function: %s", fn.Type())
+	}
+	if len(args) != len(function.Parameters) {
+		return object.NewError("wrong number of arguments: want=%d, got=%d", len(function.Parameters), len(args))
+	}
+	extendedEnv := extendFunctionEnv(function, args)
+	evaluated := Eval(function.Body, extendedEnv)
+	if err, ok := evaluated.(*object.Error); ok {
+		err.Stack = append(err.Stack, object.Frame{Function: function.Name, CallSite: callSite})
+	}
+	return unwrapReturnValue(evaluated)
+}
+
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env := object.NewEnclosedEnvironment(fn.Env)
+	for i, param := range fn.Parameters {
+		env.Set(param.Value, args[i])
+	}
+	return env
+}
+
+// the return value must not bubble out of the function, otherwise it would
+// also stop the caller
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	return obj
+}
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
+
+// isAbrupt tells whether obj has to be passed on instead of used as a value:
+// an error, or a return, break or continue coming out of a block that is
+// used as a value, like in let y = if (done) { break };
+func isAbrupt(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+		return true
+	}
+	return false
+}
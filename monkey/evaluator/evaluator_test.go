@@ -0,0 +1,827 @@
+package evaluator
+
+import (
+	"testing"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/lexer"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+	"github.com/fandan-nyc/all-interpretors/monkey/parser"
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+func testEval(t *testing.T, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors for %q: %v", input, p.Errors())
+	}
+	env := object.NewEnvironment()
+	return Eval(program, env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got %T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. expect %d, got %d", expected, result.Value)
+		return false
+	}
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got %T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. expect %t, got %t", expected, result.Value)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got %T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"--10", 10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true == true", true},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"(1 > 2) == true", false},
+		{"!true", false},
+		{"!!true", true},
+		{"!5", false},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (true) { }", nil},
+		{"if (true) { let a = 1; }", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{`if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+  return 1;
+}`, 10},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { if (10 > 1) { return true + false; } return 1; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"10 / 0", "division by zero"},
+		{"let f = fn(x) { x }; f(1, 2)", "wrong number of arguments: want=1, got=2"},
+		{"5(1)", "not a function: INTEGER"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`"Hello" + 1`, "type mismatch: STRING + INTEGER"},
+		{"5 % 0", "division by zero"},
+		{"x += 1", "identifier not found: x"},
+		{"let x = true; x += 1", "type mismatch: BOOLEAN + INTEGER"},
+		{"true && foo", "identifier not found: foo"},
+		{"[1, 2][true]", "array index must be INTEGER, got BOOLEAN"},
+		{"1[0]", "index operator not supported: INTEGER"},
+		{"[1, foo]", "identifier not found: foo"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expect %q, got %q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	evaluated := testEval(t, "fn(x) { x + 2; };")
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got %T (%+v)", evaluated, evaluated)
+	}
+	if len(fn.Parameters) != 1 || fn.Parameters[0].String() != "x" {
+		t.Fatalf("function has wrong parameters: %+v", fn.Parameters)
+	}
+	if fn.Body.String() != "(x + 2)" {
+		t.Fatalf("body is not %q, got %q", "(x + 2)", fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(t, input), 4)
+}
+
+func TestRecursiveFunction(t *testing.T) {
+	input := `
+let fib = fn(n) {
+  if (n < 2) { return n; }
+  fib(n - 1) + fib(n - 2);
+};
+fib(20);`
+
+	testIntegerObject(t, testEval(t, input), 6765)
+}
+
+func TestStringLiteral(t *testing.T) {
+	evaluated := testEval(t, `"Hello\tWorld!\n"`)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got %T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "Hello\tWorld!\n" {
+		t.Errorf("String has wrong value. got %q", str.Value)
+	}
+}
+
+func TestStringInfixExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"Hello" + " " + "World!"`, "Hello World!"},
+		{`let greet = fn(name) { "hi " + name }; greet("monkey")`, "hi monkey"},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" < "b"`, true},
+		{`"b" > "a" + "c"`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expect %q, got %q", expected, str.Value)
+			}
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"7 / 2.0", 3.5},
+		{"7 / 2", int64(3)},
+		{"0xFF + 1_000", int64(1255)},
+		{"2.0 * 3", 6.0},
+		{"1 == 1.0", true},
+		{"0.1 < 0.2", true},
+		{"2.5 > 3", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case float64:
+			result, ok := evaluated.(*object.Float)
+			if !ok {
+				t.Errorf("%s: object is not Float. got %T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if result.Value != expected {
+				t.Errorf("%s: expected %g, got %g", tt.input, expected, result.Value)
+			}
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestCompoundOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"2 >= 3", false},
+		{"2.5 >= 2", true},
+		{`"a" <= "b"`, true},
+		{"7 % 3", int64(1)},
+		{"-7 % 3", int64(-1)},
+		{"7.5 % 2", 1.5},
+		{"2 ** 10", int64(1024)},
+		{"2 ** 3 ** 2", int64(512)},
+		{"-2 ** 2", int64(-4)},
+		{"2 ** -1", 0.5},
+		{"4.0 ** 0.5", 2.0},
+		{"true && false", false},
+		{"true && 1", true},
+		{"false || 0", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"let x = 1; x += 2; x", int64(3)},
+		{"let x = 10; x -= 2 * 3", int64(4)},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"let x = 1; let f = fn() { x += 1 }; f(); f(); x", int64(3)},
+		{"let x = 1; let f = fn() { let x = 5; x += 1 }; f(); x", int64(1)},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case float64:
+			result, ok := evaluated.(*object.Float)
+			if !ok || result.Value != expected {
+				t.Errorf("%s: expected %g, got %T (%+v)", tt.input, expected, evaluated, evaluated)
+			}
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			result, ok := evaluated.(*object.String)
+			if !ok || result.Value != expected {
+				t.Errorf("%s: expected %q, got %T (%+v)", tt.input, expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	tests := []string{
+		"false && undefined",
+		"true || undefined",
+		"let x = 0; let f = fn() { x += 1; true }; false && f(); true || f(); x == 0",
+	}
+
+	for _, input := range tests {
+		evaluated := testEval(t, input)
+		if isError(evaluated) {
+			t.Errorf("%s: right side should not be evaluated, got %s", input, evaluated.Inspect())
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	evaluated := testEval(t, "[1, 2 * 2, 3 + 3]")
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got %T (%+v)", evaluated, evaluated)
+	}
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong number of elements. got %d", len(result.Elements))
+	}
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+	if result.Inspect() != "[1, 4, 6]" {
+		t.Errorf("wrong inspect, got %s", result.Inspect())
+	}
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[[1, 2], [3, 4]][1][0]", 3},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-4]", nil},
+		{"[][0]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len("naïve")`, 5},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments: want=1, got=2"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int64{2, 3}},
+		{`rest([1])`, []int64{}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int64{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`push([1])`, "wrong number of arguments: want=2, got=1"},
+		{`let a = [1]; let b = push(a, 2); len(a)`, 1},
+		{`let a = [1, 2]; rest(a); a`, []int64{1, 2}},
+		{`let len = fn(x) { 42 }; len([])`, 42},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expect %q, got %q", expected, errObj.Message)
+			}
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong number of elements. want %d, got %d", len(expected), len(array.Elements))
+				continue
+			}
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], el)
+			}
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got %T (%+v)", evaluated, evaluated)
+	}
+
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
+	}
+	if result.Len() != len(expected) {
+		t.Fatalf("hash has wrong number of pairs. got %d", result.Len())
+	}
+	for _, tt := range expected {
+		value, ok := result.Get(tt.key)
+		if !ok {
+			t.Errorf("no pair for given key in pairs")
+			continue
+		}
+		testIntegerObject(t, value, tt.value)
+	}
+	if result.Inspect() != "{one: 1, two: 2, three: 3, 4: 4, true: 5, false: 6}" {
+		t.Errorf("pairs should be in source order, got %s", result.Inspect())
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+		{`{"a": {"b": [1, 2]}}["a"]["b"][-1]`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys({"b": 1, "a": 2, 3: 3})`, "[b, a, 3]"},
+		{`values({"b": 1, "a": 2, 3: 3})`, "[1, 2, 3]"},
+		{`keys({})`, "[]"},
+		{`has({"a": 1}, "a")`, "true"},
+		{`has({"a": 1}, "b")`, "false"},
+		{`has({1: 1}, true)`, "false"},
+		{`delete({"a": 1, "b": 2, "c": 3}, "b")`, "{a: 1, c: 3}"},
+		{`delete({"a": 1}, "z")`, "{a: 1}"},
+		{`let h = {"a": 1}; delete(h, "a"); h`, "{a: 1}"},
+		{`len({"a": 1, "b": 2})`, "2"},
+		{`keys([1])`, "ERROR: argument to `keys` must be HASH, got ARRAY"},
+		{`has({})`, "ERROR: wrong number of arguments: want=2, got=1"},
+		{`delete({}, [1])`, "ERROR: unusable as hash key: ARRAY"},
+		{`{[1]: 2}`, "ERROR: unusable as hash key: ARRAY"},
+		{`{"a": 1}[fn(x) { x }]`, "ERROR: unusable as hash key: FUNCTION"},
+		{`{1.5: 1}`, "ERROR: unusable as hash key: FLOAT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; x = x + 1; x", "2"},
+		{"let x = 1; x = 5", "5"},
+		{"let x = 1; let y = 2; x = y = 3; x + y", "6"},
+		{`let x = 1; x = "now a string"; x`, "now a string"},
+		{"let count = 0; let inc = fn() { count = count + 1 }; inc(); inc(); count", "2"},
+		{"let x = 1; let f = fn(x) { x = 10 }; f(0); x", "1"},
+		{"const x = 1; let f = fn() { let x = 2; x = 3; x }; f()", "3"},
+		{"let a = [1, 2, 3]; a[0] = 5; a", "[5, 2, 3]"},
+		{"let a = [1, 2, 3]; a[-1] = 5; a", "[1, 2, 5]"},
+		{"let a = [1, 2, 3]; let b = a; b[1] = 7; a", "[1, 7, 3]"},
+		{"let a = [1, 2, 3]; a[1] += 10", "12"},
+		{"const a = [1]; a[0] = 2; a", "[2]"},
+		{`let h = {"k": 1}; h["k"] = 2; h["new"] = 3; h`, "{k: 2, new: 3}"},
+		{`let h = {"k": 1}; h["k"] -= 3; h["k"]`, "-2"},
+		{`let h = {"a": [0]}; h["a"][0] = "x"; h`, "{a: [x]}"},
+		{"x = 1", "ERROR: identifier not found: x"},
+		{"const x = 1; x = 2", "ERROR: cannot assign to constant x"},
+		{"const x = 1; x += 2", "ERROR: cannot assign to constant x"},
+		{"const x = 1; let f = fn() { x = 2 }; f()", "ERROR: cannot assign to constant x"},
+		{"const x = 1; let x = 2; x = 3; x", "ERROR: cannot redeclare constant x"},
+		{"const x = 1; const x = 2; x", "ERROR: cannot redeclare constant x"},
+		{"let x = 1; const x = 2; x = 3", "ERROR: cannot assign to constant x"},
+		{"const x = 1; let f = fn() { const x = 2; x }; f()", "2"},
+		{"let a = [1]; a[1] = 2", "ERROR: index out of range: 1 with length 1"},
+		{`let a = [1]; a["0"] = 2`, "ERROR: array index must be INTEGER, got STRING"},
+		{`let h = {}; h["k"] += 1`, "ERROR: key not found: k"},
+		{`let h = {}; h[[1]] = 1`, "ERROR: unusable as hash key: ARRAY"},
+		{`let s = "abc"; s[0] = "x"`, "ERROR: index assignment not supported: STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let i = 0; while (i < 5) { i += 1 }; i", "5"},
+		{"let i = 0; while (false) { i += 1 }; i", "0"},
+		{"let i = 0; while (true) { i += 1; if (i == 3) { break } }; i", "3"},
+		{"let i = 0; let s = 0; while (i < 5) { i += 1; if (i % 2 == 0) { continue } s += i }; s", "9"},
+		{"let s = 0; for (x in [1, 2, 3]) { s += x }; s", "6"},
+		{"let s = 0; for (x in []) { s += 1 }; s", "0"},
+		{`let ks = ""; for (k in {"b": 1, "a": 2}) { ks += k }; ks`, "ba"},
+		{`let out = []; for (c in "héllo") { out = push(out, c) }; out`, "[h, é, l, l, o]"},
+		{"let s = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue } if (x == 4) { break } s += x }; s", "4"},
+		{"let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break } n += 1 } }; n", "2"},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x } } 0 }; f()", "2"},
+		{"let f = fn() { while (true) { return 7 } }; f()", "7"},
+		{"let fs = []; for (x in [1, 2]) { fs = push(fs, fn() { x }) }; fs[0]() + fs[1]()", "3"},
+		{"for (x in [1]) { let inner = x }; inner", "ERROR: identifier not found: inner"},
+		{"let a = [1, 2]; let n = 0; for (x in a) { a[1] = 10; n += x }; n", "3"},
+		{"let f = fn() { while (true) { } }; let i = 0; while (i < 1) { i += 1 }", "null"},
+		{"for (x in 5) { x }", "ERROR: cannot iterate over INTEGER"},
+		{"while (y) { 1 }", "ERROR: identifier not found: y"},
+		{"for (x in [1, 2]) { x + true }", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{"let i = 0; while (i < 100000) { i += 1 }; i", "100000"},
+		// break, continue and return out of a block used as a value
+		{"let i = 0; while (i < 3) { let y = if (true) { break }; i += 1 }; i", "0"},
+		{"let s = 0; for (x in [1, 2, 3]) { s += if (x == 2) { continue } else { x } }; s", "4"},
+		{"let n = 0; for (x in [1, 2, 3]) { let a = [x, if (x == 2) { continue }]; n += 1 }; n", "2"},
+		{"let f = fn() { let y = if (true) { return 5 }; 0 }; f()", "5"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil {
+			evaluated = NULL
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		line     int
+		column   int
+		expected []object.Frame
+	}{
+		{"5 + true", 1, 1, nil},
+		{"(5 + 1) * true", 1, 1, nil},
+		{"let x = 1;\nlet y = x * -true;", 2, 13, nil},
+		{"if (true) {\n  foo\n}", 2, 3, nil},
+		{"len(1)", 1, 1, nil},
+		{
+			"let add = fn(a, b) { a + b };\nadd(1, false)",
+			1, 22,
+			[]object.Frame{{Function: "add", CallSite: token.Position{Line: 2, Column: 1}}},
+		},
+		{
+			"let inner = fn() { missing };\nlet outer = fn() {\n  1 + inner()\n};\nouter()",
+			1, 20,
+			[]object.Frame{
+				{Function: "inner", CallSite: token.Position{Line: 3, Column: 7}},
+				{Function: "outer", CallSite: token.Position{Line: 5, Column: 1}},
+			},
+		},
+		{
+			"fn(x) { x / 0 }(1)",
+			1, 9,
+			[]object.Frame{{Function: "", CallSite: token.Position{Line: 1, Column: 1}}},
+		},
+		{
+			"let f = fn(x) { x }; f(1, 2)",
+			1, 22,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Pos.Line != tt.line || errObj.Pos.Column != tt.column {
+			t.Errorf("%q: expected error at %d:%d, got %s", tt.input, tt.line, tt.column, errObj.Pos)
+		}
+		if len(errObj.Stack) != len(tt.expected) {
+			t.Errorf("%q: expected %d frames, got %d", tt.input, len(tt.expected), len(errObj.Stack))
+			continue
+		}
+		for i, frame := range tt.expected {
+			actual := errObj.Stack[i]
+			if actual.Function != frame.Function ||
+				actual.CallSite.Line != frame.CallSite.Line || actual.CallSite.Column != frame.CallSite.Column {
+				t.Errorf("%q: frame %d: expected %s at %s, got %s at %s",
+					tt.input, i, frame.Function, frame.CallSite, actual.Function, actual.CallSite)
+			}
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1 } catch (e) { 2 }", "1"},
+		{"try { 1 + true } catch (e) { 2 }", "2"},
+		{`try { throw "boom" } catch (e) { e["message"] }`, "boom"},
+		{`try { throw {"code": 42} } catch (e) { e["value"]["code"] }`, "42"},
+		{`try { throw 42 } catch (e) { e["message"] }`, "42"},
+		{"try { missing } catch (e) { e }", "ERROR: identifier not found: missing"},
+		{"try { missing } catch (e) { e[\"message\"] }", "identifier not found: missing"},
+		{"try { missing } catch (e) { e[\"value\"] }", "identifier not found: missing"},
+		{"try {\n  1;\n  5 / 0\n} catch (e) { [e[\"line\"], e[\"column\"]] }", "[3, 3]"},
+		{"try { 1 } catch (e) { 2 }; e", "ERROR: identifier not found: e"},
+		{"try { throw 1 } catch (e) { e[\"nope\"] }", "null"},
+		{"try { throw 1 } catch (e) { e[0] }", "ERROR: error field must be STRING, got INTEGER"},
+		{"let f = fn() { throw \"deep\" }; let g = fn() { f() }; try { g() } catch (e) { e[\"message\"] }", "deep"},
+		{"let f = fn() { try { throw 1 } catch (e) { return 2 }; 3 }; f()", "2"},
+		{"try { throw 1 } catch (e) { throw \"again\" }", "ERROR: again"},
+		{"try { try { throw 1 } catch (e) { throw e } } catch (e) { e[\"value\"] + 1 }", "2"},
+		{"throw \"uncaught\"; 5", "ERROR: uncaught"},
+		{"let log = []; try { log = push(log, 1) } finally { log = push(log, 2) }; log", "[1, 2]"},
+		{"let log = []; try { throw 1 } catch (e) { log = push(log, 1) } finally { log = push(log, 2) }; log", "[1, 2]"},
+		{"let n = 0; try { throw \"x\" } finally { n = 1 }", "ERROR: x"},
+		{"let n = 0; try { try { throw \"x\" } finally { n = 1 } } catch (e) { n }", "1"},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", "2"},
+		{"let f = fn() { try { return 1 } finally { 2 } }; f()", "1"},
+		{"try { throw 1 } catch (e) { 2 } finally { throw 3 }", "ERROR: 3"},
+		{"let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { break } n += x } finally { n += 10 } }; n", "21"},
+		{"let n = 0; for (x in [1, 2]) { try { throw x } catch (e) { n += e[\"value\"]; continue } n += 100 }; n", "3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestRethrowKeepsStack(t *testing.T) {
+	input := `let f = fn() { throw "boom" };
+let g = fn() {
+  try { f() } catch (e) { throw e }
+};
+g()`
+	evaluated := testEval(t, input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got %T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Pos.Line != 1 || errObj.Pos.Column != 16 {
+		t.Errorf("a rethrown error should keep its first position, got %s", errObj.Pos)
+	}
+	if len(errObj.Stack) != 2 || errObj.Stack[0].Function != "f" || errObj.Stack[1].Function != "g" {
+		t.Errorf("expected frames f and g, got %+v", errObj.Stack)
+	}
+}
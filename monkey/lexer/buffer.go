@@ -0,0 +1,101 @@
+package lexer
+
+import "github.com/fandan-nyc/all-interpretors/monkey/token"
+
+// TokenSource hands out tokens one at a time, like *Lexer does
+type TokenSource interface {
+	NextToken() token.Token
+}
+
+// Tokenize lexes the whole input, the EOF token included
+func Tokenize(input string) []token.Token {
+	l := New(input)
+	var tokens []token.Token
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
+// Mark is a position in a Buffer that can be gone back to
+type Mark int
+
+// Buffer sits between a TokenSource and a parser. it gives arbitrary
+// lookahead with Peek and backtracking with Mark and Reset.
+//
+// tokens are only kept while somebody could still need them: the ones that
+// were peeked at, and everything after the oldest mark that is still open.
+type Buffer struct {
+	src    TokenSource
+	tokens []token.Token // tokens[0] is the token with index base
+	base   int           // index of tokens[0] in the whole token stream
+	pos    int           // index of the token Next returns
+	marks  []Mark        // open marks, oldest first
+}
+
+func NewBuffer(src TokenSource) *Buffer {
+	return &Buffer{src: src}
+}
+
+// Next returns the next token and moves past it. after EOF it keeps returning EOF.
+func (b *Buffer) Next() token.Token {
+	tok := b.Peek(0)
+	if tok.Type != token.EOF || b.pos-b.base < len(b.tokens)-1 {
+		b.pos++
+	}
+	b.compact()
+	return tok
+}
+
+// Peek returns the token n places ahead without moving, Peek(0) is the token
+// Next would return
+func (b *Buffer) Peek(n int) token.Token {
+	i := b.pos - b.base + n
+	for len(b.tokens) <= i {
+		if len(b.tokens) > 0 && b.tokens[len(b.tokens)-1].Type == token.EOF {
+			return b.tokens[len(b.tokens)-1]
+		}
+		b.tokens = append(b.tokens, b.src.NextToken())
+	}
+	return b.tokens[i]
+}
+
+// Mark remembers the current position. every mark has to be ended with
+// either Reset or Release, otherwise the buffer keeps every token from then on.
+func (b *Buffer) Mark() Mark {
+	m := Mark(b.pos)
+	b.marks = append(b.marks, m)
+	return m
+}
+
+// Reset goes back to the mark and ends it, along with any mark made after it
+func (b *Buffer) Reset(m Mark) {
+	b.pos = int(m)
+	b.Release(m)
+}
+
+// Release ends the mark without moving, along with any mark made after it
+func (b *Buffer) Release(m Mark) {
+	for i := len(b.marks) - 1; i >= 0; i-- {
+		if b.marks[i] == m {
+			b.marks = b.marks[:i]
+			break
+		}
+	}
+	b.compact()
+}
+
+// compact drops the tokens nobody can go back to anymore
+func (b *Buffer) compact() {
+	keep := b.pos
+	if len(b.marks) > 0 {
+		keep = int(b.marks[0])
+	}
+	if drop := keep - b.base; drop > 0 && drop <= len(b.tokens) {
+		b.tokens = append(b.tokens[:0], b.tokens[drop:]...)
+		b.base = keep
+	}
+}
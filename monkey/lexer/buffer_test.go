@@ -0,0 +1,79 @@
+package lexer
+
+import (
+	"testing"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("let x = 5;")
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON, token.EOF}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d", len(expected), len(tokens))
+	}
+	for i, tt := range expected {
+		if tokens[i].Type != tt {
+			t.Errorf("tokens[%d]: expected %q, got %q", i, tt, tokens[i].Type)
+		}
+	}
+	if tokens[3].Pos.String() != "1:9" {
+		t.Errorf("tokens keep their positions, expected 1:9, got %s", tokens[3].Pos)
+	}
+}
+
+func TestBufferPeek(t *testing.T) {
+	b := NewBuffer(New("a b c"))
+	tests := []struct {
+		n        int
+		expected string
+	}{
+		{2, "c"},
+		{0, "a"},
+		{1, "b"},
+		{3, "\x00"},
+		{10, "\x00"},
+	}
+	for i, tt := range tests {
+		if tok := b.Peek(tt.n); tok.Literal != tt.expected {
+			t.Errorf("tests[%d]: Peek(%d) expected %q, got %q", i, tt.n, tt.expected, tok.Literal)
+		}
+	}
+
+	for _, expected := range []string{"a", "b", "c", "\x00", "\x00"} {
+		if tok := b.Next(); tok.Literal != expected {
+			t.Errorf("Next expected %q, got %q", expected, tok.Literal)
+		}
+	}
+}
+
+func TestBufferMarkReset(t *testing.T) {
+	b := NewBuffer(New("a b c d e"))
+	b.Next()
+
+	outer := b.Mark()
+	b.Next()
+	inner := b.Mark()
+	b.Next()
+	b.Next()
+
+	b.Reset(inner)
+	if tok := b.Next(); tok.Literal != "c" {
+		t.Fatalf("after resetting to inner expected c, got %q", tok.Literal)
+	}
+
+	b.Reset(outer)
+	if tok := b.Next(); tok.Literal != "b" {
+		t.Fatalf("after resetting to outer expected b, got %q", tok.Literal)
+	}
+
+	m := b.Mark()
+	b.Next()
+	b.Release(m)
+	if tok := b.Next(); tok.Literal != "d" {
+		t.Fatalf("release should not move, expected d, got %q", tok.Literal)
+	}
+	if len(b.tokens) > 1 {
+		t.Errorf("without open marks the consumed tokens should be dropped, still holding %d", len(b.tokens))
+	}
+}
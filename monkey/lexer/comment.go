@@ -0,0 +1,74 @@
+package lexer
+
+import "github.com/fandan-nyc/all-interpretors/monkey/token"
+
+// Mode changes what the lexer does with things that are not tokens
+type Mode uint
+
+const (
+	// KeepComments attaches comments to the token that follows them as
+	// token.Comments, instead of throwing them away. a formatter or doc
+	// generator needs this to round-trip the source.
+	KeepComments Mode = 1 << iota
+)
+
+// SetMode must be called before the first NextToken
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
+}
+
+// skipTrivia skips whitespace and comments in front of the next token and
+// returns the comments. terminated is false when the last comment is a
+// block comment that runs into the end of the input.
+func (l *Lexer) skipTrivia() (comments []token.Comment, terminated bool) {
+	for {
+		l.skipWhitespace()
+		if l.ch != '/' {
+			return comments, true
+		}
+		switch l.peekChar() {
+		case '/':
+			comments = append(comments, l.readLineComment())
+		case '*':
+			comment, ok := l.readBlockComment()
+			comments = append(comments, comment)
+			if !ok {
+				return comments, false
+			}
+		default:
+			return comments, true
+		}
+	}
+}
+
+// readLineComment reads up to, but not including, the end of the line
+func (l *Lexer) readLineComment() token.Comment {
+	l.startText()
+	start := l.pos()
+	for l.ch != '\n' && !l.atEOF() {
+		l.readChar()
+	}
+	text := l.textBetween(start.Offset, l.position)
+	if len(text) > 0 && text[len(text)-1] == '\r' {
+		text = text[:len(text)-1]
+	}
+	return token.Comment{Text: text, Pos: start}
+}
+
+// readBlockComment reads a /* */ comment. block comments do not nest.
+func (l *Lexer) readBlockComment() (token.Comment, bool) {
+	l.startText()
+	start := l.pos()
+	l.readChar()
+	l.readChar()
+	for !(l.ch == '*' && l.peekChar() == '/') {
+		if l.atEOF() {
+			l.errorf(start, "unterminated block comment")
+			return token.Comment{Text: l.textBetween(start.Offset, l.position), Pos: start}, false
+		}
+		l.readChar()
+	}
+	l.readChar()
+	l.readChar()
+	return token.Comment{Text: l.textBetween(start.Offset, l.position), Pos: start}, true
+}
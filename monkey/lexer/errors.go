@@ -0,0 +1,37 @@
+package lexer
+
+import (
+	"fmt"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+// Error is a lexical error, e.g. an unterminated string. the lexer still
+// returns a token.ILLEGAL for it, so the parser sees where it happened.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// Errors returns the lexical errors found so far, in source order
+func (l *Lexer) Errors() []*Error {
+	return l.errors
+}
+
+// ErrorAt returns the first error reported inside the given token, if any
+func (l *Lexer) ErrorAt(tok token.Token) (*Error, bool) {
+	for _, e := range l.errors {
+		if e.Pos.Offset >= tok.Pos.Offset && (e.Pos.Offset < tok.End.Offset || e.Pos.Offset == tok.Pos.Offset) {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+func (l *Lexer) errorf(pos token.Position, format string, args ...interface{}) {
+	l.errors = append(l.errors, &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
@@ -1,39 +1,160 @@
 package lexer
 
-import "github.com/fandan-nyc/all-interpretors/monkey/token"
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+// the lexer works on runes: positions keep byte offsets, but columns are
+// counted in runes, which is what editors expect.
+//
+// the input is read through a bufio.Reader, so a string and a stream are
+// lexed by the same code and give the same tokens. only the raw text of the
+// token being lexed is kept in memory.
 type Lexer struct {
-	input        string
-	position     int  // current position in input (position of current char)
-	readPosition int  // current reading position in input (after current char)
-	ch           byte // current chat under examination
+	src          *bufio.Reader
+	filename     string
+	position     int    // current position in input (position of current char)
+	readPosition int    // current reading position in input (after current char)
+	ch           rune   // current chat under examination
+	badEncoding  bool   // ch is utf8.RuneError because the input is not valid UTF-8
+	eof          bool   // ch is past the end of the input
+	line         int    // line of the current char
+	column       int    // column of the current char, in runes
+	text         []byte // raw input from textStart up to readPosition
+	textStart    int
+	errors       []*Error
+	readErr      error // reported when the lexer reaches the end of what was read
+	mode         Mode
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile is like New, but every token position also carries the file name
+func NewFile(filename, input string) *Lexer {
+	return NewFileReader(filename, strings.NewReader(input))
+}
+
+// NewReader lexes the input as it is read from r, so large files and
+// stdin do not have to be loaded into memory first
+func NewReader(r io.Reader) *Lexer {
+	return NewFileReader("", r)
+}
+
+// NewFileReader is like NewReader, but every token position also carries the file name
+func NewFileReader(filename string, r io.Reader) *Lexer {
+	l := &Lexer{src: bufio.NewReader(r), filename: filename, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+	if l.eof {
+		return
+	}
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
 	}
+	l.column += 1
 	l.position = l.readPosition
-	l.readPosition += 1
+
+	// peek enough bytes for any rune, and only consume what it actually used
+	buf := l.peek()
+	if len(buf) == 0 {
+		if l.readErr != nil {
+			l.errorf(l.pos(), "read error: %s", l.readErr)
+		}
+		l.ch = 0
+		l.badEncoding = false
+		l.eof = true
+		return
+	}
+	ch, width := utf8.DecodeRune(buf)
+	l.ch = ch
+	l.badEncoding = ch == utf8.RuneError && width == 1
+	l.text = append(l.text, buf[:width]...)
+	l.readPosition += width
+	l.src.Discard(width)
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+// peek returns the next bytes of the input without consuming them.
+// bufio.Reader reports a read error only once, so whichever peek sees it
+// keeps it, and after it the reader is not read again.
+func (l *Lexer) peek() []byte {
+	if l.readErr != nil {
+		n := l.src.Buffered()
+		if n > utf8.UTFMax {
+			n = utf8.UTFMax
+		}
+		buf, _ := l.src.Peek(n)
+		return buf
+	}
+	buf, err := l.src.Peek(utf8.UTFMax)
+	if err != nil && err != io.EOF {
+		l.readErr = err
+	}
+	return buf
+}
+
+func (l *Lexer) peekChar() rune {
+	buf := l.peek()
+	if len(buf) == 0 {
 		return 0
 	}
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRune(buf)
+	return ch
+}
+
+// startText drops the raw text read so far, keeping only the current char
+func (l *Lexer) startText() {
+	l.text = l.text[l.position-l.textStart:]
+	l.textStart = l.position
+}
+
+// textBetween returns the raw input between two offsets. from must not be
+// before the last startText.
+func (l *Lexer) textBetween(from, to int) string {
+	return string(l.text[from-l.textStart : to-l.textStart])
 }
+
+// pos is the position of the current char
+func (l *Lexer) pos() token.Position {
+	return token.Position{Filename: l.filename, Offset: l.position, Line: l.line, Column: l.column}
+}
+
 func (l *Lexer) NextToken() token.Token {
+	comments, terminated := l.skipTrivia()
+	if !terminated {
+		// the unterminated block comment becomes the token, so the parser reports it
+		last := comments[len(comments)-1]
+		return token.Token{Type: token.ILLEGAL, Literal: last.Text, Pos: last.Pos, End: l.pos()}
+	}
+	l.startText()
+	start := l.pos()
+	tok := l.readToken()
+	tok.Pos = start
+	tok.End = l.pos()
+	if tok.Type == token.EOF {
+		tok.End = start
+	}
+	if l.mode&KeepComments != 0 {
+		tok.Comments = comments
+	}
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
-	l.skipWhitespace()
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -55,8 +176,10 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.twoCharToken('=', token.PLUS_ASSIGN, token.PLUS)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -65,18 +188,38 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.twoCharToken('=', token.MINUS_ASSIGN, token.MINUS)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.twoCharToken('*', token.POWER, token.ASTERISK)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '/':
 		tok = newToken(token.SLASH, l.ch)
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		tok = l.twoCharToken('=', token.GT_EQ, token.GT)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		tok = l.twoCharToken('=', token.LT_EQ, token.LT)
+	case '&':
+		tok = l.doubleCharToken(token.AND)
+	case '|':
+		tok = l.doubleCharToken(token.OR)
+	case '"':
+		return l.readString() // the closing quote is already consumed
 	case 0:
-		tok = newToken(token.EOF, l.ch)
+		if l.atEOF() {
+			tok = newToken(token.EOF, l.ch)
+		} else if l.badEncoding {
+			l.errorf(l.pos(), "invalid UTF-8 encoding")
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.textBetween(l.position, l.readPosition)}
+		} else {
+			l.errorf(l.pos(), "illegal character %q", l.ch)
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
@@ -84,10 +227,12 @@ func (l *Lexer) NextToken() token.Token {
 			return tok // early termination is important here. once we get an identifier, we should return the token
 			// the pointer are in the right place already
 		} else if isNumber(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
-			return tok
+			return l.readNumber()
+		} else if l.badEncoding {
+			l.errorf(l.pos(), "invalid UTF-8 encoding")
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.textBetween(l.position, l.readPosition)}
 		} else {
+			l.errorf(l.pos(), "illegal character %q", l.ch)
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
@@ -95,44 +240,162 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+// twoCharToken is for operators like <= whose first char is an operator on its own too
+func (l *Lexer) twoCharToken(next rune, twoCharType, oneCharType token.TokenType) token.Token {
+	if l.peekChar() != next {
+		return newToken(oneCharType, l.ch)
+	}
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: twoCharType, Literal: string(ch) + string(l.ch)}
+}
+
+// doubleCharToken is for && and ||, where the single char is not an operator
+func (l *Lexer) doubleCharToken(tokenType token.TokenType) token.Token {
+	if l.peekChar() != l.ch {
+		l.errorf(l.pos(), "illegal character %q, did you mean %s?", l.ch, tokenType)
+		return newToken(token.ILLEGAL, l.ch)
+	}
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
+func (l *Lexer) atEOF() bool {
+	return l.eof
+}
+
+// readString reads a double quoted string starting at the opening quote.
+// the token literal is the string with its escape sequences resolved. a bad
+// escape or a missing closing quote gives an ILLEGAL token holding the raw source.
+func (l *Lexer) readString() token.Token {
+	start := l.pos()
+	var out bytes.Buffer
+	valid := true
+	for {
+		l.readChar()
+		if l.atEOF() {
+			l.errorf(start, "unterminated string literal")
+			return token.Token{Type: token.ILLEGAL, Literal: l.textBetween(start.Offset, l.position)}
+		}
+		if l.ch == '"' {
+			break
+		}
+		if l.badEncoding {
+			l.errorf(l.pos(), "invalid UTF-8 encoding in string literal")
+			valid = false
+			continue
+		}
+		if l.ch != '\\' {
+			out.WriteRune(l.ch)
+			continue
+		}
+		escapePos := l.pos()
+		l.readChar()
+		switch l.ch {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		case '"':
+			out.WriteByte('"')
+		case '\\':
+			out.WriteByte('\\')
+		case 'u':
+			r, ok := l.readUnicodeEscape()
+			if !ok {
+				l.errorf(escapePos, "invalid unicode escape, expected \\u{...} with at most 6 hex digits")
+				valid = false
+				continue
+			}
+			out.WriteRune(r)
+		default:
+			if l.atEOF() {
+				// let the next iteration report the unterminated string
+				continue
+			}
+			l.errorf(escapePos, "unknown escape sequence \\%c", l.ch)
+			valid = false
+		}
+	}
+	l.readChar()
+	if !valid {
+		return token.Token{Type: token.ILLEGAL, Literal: l.textBetween(start.Offset, l.position)}
+	}
+	return token.Token{Type: token.STRING, Literal: out.String()}
+}
+
+// readUnicodeEscape reads the {...} part of \u{...}, leaving the current
+// char on the closing brace
+func (l *Lexer) readUnicodeEscape() (rune, bool) {
+	if l.peekChar() != '{' {
+		return 0, false
+	}
+	l.readChar()
+	position := l.readPosition
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+	}
+	digits := l.textBetween(position, l.readPosition)
+	if l.peekChar() != '}' {
+		return 0, false
+	}
+	l.readChar()
+	if len(digits) == 0 || len(digits) > 6 {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(value)) {
+		return 0, false
+	}
+	return rune(value), true
+}
+
+func isHexDigit(ch rune) bool {
+	return isNumber(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
-func (l *Lexer) checkHelper(checkfunc func(byte) bool) string {
+func (l *Lexer) checkHelper(checkfunc func(rune) bool) string {
 	position := l.position
 	for checkfunc(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return l.textBetween(position, l.position)
 }
 
-func isLetter(ch byte) bool {
-	var lower = 'a' <= ch && ch <= 'z'
-	var upper = 'A' <= ch && ch <= 'Z'
-	var underscore = ch == '_'
-	return lower || upper || underscore
+// identifiers start with a Unicode letter or an underscore, followed by any
+// number of Unicode letters, underscores and Unicode decimal digits.
+// so `café` and `x1` are identifiers, `1x` is a number followed by one.
+func isLetter(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch)
 }
 
-func isWhitespace(ch byte) bool {
+func isIdentifierChar(ch rune) bool {
+	return isLetter(ch) || unicode.IsDigit(ch)
+}
+
+func isWhitespace(ch rune) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
 }
 
-func isNumber(ch byte) bool {
+// numbers are always ASCII digits
+func isNumber(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
 func (l *Lexer) readIdentifier() string {
-	return l.checkHelper(isLetter)
+	return l.checkHelper(isIdentifierChar)
 }
 
 func (l *Lexer) skipWhitespace() {
-	if l.position >= len(l.input) {
+	if l.atEOF() {
 		return
 	}
 	l.checkHelper(isWhitespace)
 }
-
-func (l *Lexer) readNumber() string {
-	return l.checkHelper(isNumber)
-}
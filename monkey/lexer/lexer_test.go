@@ -6,7 +6,7 @@ import (
 )
 
 func TestNextToken(t *testing.T) {
-	input := `=+(){},;-!/*<>`
+	input := `=+(){},;-!/ *<>`
 
 	tests := []struct {
 		expectedType    token.TokenType
@@ -62,6 +62,11 @@ let result = add(five, ten);
 
 10 == 10;
 10 != 9;
+[1, 2];
+{"foo": "bar"}
+const x = 1;
+while for in break continue
+throw try catch finally
 `
 
 	tests := []struct {
@@ -130,6 +135,31 @@ let result = add(five, ten);
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+		{token.CONST, "const"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.IN, "in"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.THROW, "throw"},
+		{token.TRY, "try"},
+		{token.CATCH, "catch"},
+		{token.FINALLY, "finally"},
 
 		{token.EOF, "\x00"},
 	}
@@ -145,3 +175,360 @@ let result = add(five, ten);
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 10;\n  x == 5"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     string
+		expectedOffset  int
+		expectedEnd     string
+	}{
+		{"let", "test.monkey:1:1", 0, "test.monkey:1:4"},
+		{"x", "test.monkey:1:5", 4, "test.monkey:1:6"},
+		{"=", "test.monkey:1:7", 6, "test.monkey:1:8"},
+		{"10", "test.monkey:1:9", 8, "test.monkey:1:11"},
+		{";", "test.monkey:1:11", 10, "test.monkey:1:12"},
+		{"x", "test.monkey:2:3", 14, "test.monkey:2:4"},
+		{"==", "test.monkey:2:5", 16, "test.monkey:2:7"},
+		{"5", "test.monkey:2:8", 19, "test.monkey:2:9"},
+		{"\x00", "test.monkey:2:9", 20, "test.monkey:2:9"},
+	}
+
+	l := NewFile("test.monkey", input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] failed, expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.String() != tt.expectedPos {
+			t.Errorf("tests[%d] failed, expected pos %s, got %s", i, tt.expectedPos, tok.Pos)
+		}
+		if tok.Pos.Offset != tt.expectedOffset {
+			t.Errorf("tests[%d] failed, expected offset %d, got %d", i, tt.expectedOffset, tok.Pos.Offset)
+		}
+		if tok.End.String() != tt.expectedEnd {
+			t.Errorf("tests[%d] failed, expected end %s, got %s", i, tt.expectedEnd, tok.End)
+		}
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"foobar"`, token.STRING, "foobar"},
+		{`"foo bar"`, token.STRING, "foo bar"},
+		{`""`, token.STRING, ""},
+		{`"a\nb\tc"`, token.STRING, "a\nb\tc"},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"caf\u{e9} \u{1F600}"`, token.STRING, "caf\u00e9 \U0001F600"},
+		{`"bad \q escape"`, token.ILLEGAL, `"bad \q escape"`},
+		{`"bad \u{110000}"`, token.ILLEGAL, `"bad \u{110000}"`},
+		{`"never closed`, token.ILLEGAL, `"never closed`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] failed. expected %q, got %q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] failed, expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("tests[%d] failed, expected EOF after the string, got %q", i, next.Type)
+		}
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedPos string
+		expectedMsg string
+	}{
+		{"let s = \"abc", "1:9", "unterminated string literal"},
+		{"\"a\\qb\"", "1:3", `unknown escape sequence \q`},
+		{"\"\\u{zz}\"", "1:2", `invalid unicode escape, expected \u{...} with at most 6 hex digits`},
+		{"1 @ 2", "1:3", `illegal character '@'`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+		errs := l.Errors()
+		if len(errs) != 1 {
+			t.Fatalf("tests[%d] failed, expected 1 error, got %d", i, len(errs))
+		}
+		if errs[0].Pos.String() != tt.expectedPos {
+			t.Errorf("tests[%d] failed, expected pos %s, got %s", i, tt.expectedPos, errs[0].Pos)
+		}
+		if errs[0].Msg != tt.expectedMsg {
+			t.Errorf("tests[%d] failed, expected %q, got %q", i, tt.expectedMsg, errs[0].Msg)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 5; // trailing
+/* block
+   comment */ x / 2 /**/
+// at the end`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLiteral  string
+		expectedComments []string
+	}{
+		{token.LET, "let", []string{"// leading comment"}},
+		{token.IDENT, "x", nil},
+		{token.ASSIGN, "=", nil},
+		{token.INT, "5", nil},
+		{token.SEMICOLON, ";", nil},
+		{token.IDENT, "x", []string{"// trailing", "/* block\n   comment */"}},
+		{token.SLASH, "/", nil},
+		{token.INT, "2", nil},
+		{token.EOF, "\x00", []string{"/**/", "// at the end"}},
+	}
+
+	for _, mode := range []Mode{0, KeepComments} {
+		l := New(input)
+		l.SetMode(mode)
+		for i, tt := range tests {
+			tok := l.NextToken()
+			if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+				t.Fatalf("mode %d tests[%d] failed. expected %q %q, got %q %q",
+					mode, i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+			}
+			expectedComments := tt.expectedComments
+			if mode&KeepComments == 0 {
+				expectedComments = nil
+			}
+			if len(tok.Comments) != len(expectedComments) {
+				t.Fatalf("mode %d tests[%d] failed. expected comments %q, got %+v", mode, i, expectedComments, tok.Comments)
+			}
+			for j, text := range expectedComments {
+				if tok.Comments[j].Text != text {
+					t.Errorf("mode %d tests[%d] failed. expected comment %q, got %q", mode, i, text, tok.Comments[j].Text)
+				}
+			}
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("x /* never closed\n")
+	if tok := l.NextToken(); tok.Type != token.IDENT {
+		t.Fatalf("expected IDENT, got %q", tok.Type)
+	}
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != "/* never closed\n" {
+		t.Fatalf("expected ILLEGAL for the comment, got %q %q", tok.Type, tok.Literal)
+	}
+	if tok.Pos.String() != "1:3" {
+		t.Errorf("expected the comment at 1:3, got %s", tok.Pos)
+	}
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("expected EOF, got %q", tok.Type)
+	}
+	errs := l.Errors()
+	if len(errs) != 1 || errs[0].Msg != "unterminated block comment" {
+		t.Errorf("expected an unterminated block comment error, got %v", errs)
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := "let café = naïve_2 + x1;\n\"日本\" 語"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     string
+	}{
+		{token.LET, "let", "1:1"},
+		{token.IDENT, "café", "1:5"},
+		{token.ASSIGN, "=", "1:10"},
+		{token.IDENT, "naïve_2", "1:12"},
+		{token.PLUS, "+", "1:20"},
+		{token.IDENT, "x1", "1:22"},
+		{token.SEMICOLON, ";", "1:24"},
+		{token.STRING, "日本", "2:1"},
+		{token.IDENT, "語", "2:6"},
+		{token.EOF, "\x00", "2:7"},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] failed. expected %q %q, got %q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Pos.String() != tt.expectedPos {
+			t.Errorf("tests[%d] failed, expected pos %s, got %s", i, tt.expectedPos, tok.Pos)
+		}
+	}
+	if errs := l.Errors(); len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	input := "é \xff \"a\xfeb\""
+
+	l := New(input)
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  string
+	}{
+		{token.IDENT, "1:1"},
+		{token.ILLEGAL, "1:3"},
+		{token.ILLEGAL, "1:5"},
+		{token.EOF, "1:10"},
+	}
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] failed. expected %q, got %q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos.String() != tt.expectedPos {
+			t.Errorf("tests[%d] failed, expected pos %s, got %s", i, tt.expectedPos, tok.Pos)
+		}
+	}
+
+	expected := []string{"1:3: invalid UTF-8 encoding", "1:7: invalid UTF-8 encoding in string literal"}
+	errs := l.Errors()
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Errorf("errs[%d]: expected %q, got %q", i, expected[i], e.Error())
+		}
+	}
+	if errs[1].Pos.Offset != 7 {
+		t.Errorf("offsets should stay in bytes, expected 7, got %d", errs[1].Pos.Offset)
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"123", token.INT, "123"},
+		{"0755", token.ILLEGAL, "0755"},
+		{"0.5", token.FLOAT, "0.5"},
+		{"0", token.INT, "0"},
+		{"1_000_000", token.INT, "1_000_000"},
+		{"0xFF", token.INT, "0xFF"},
+		{"0xdead_beef", token.INT, "0xdead_beef"},
+		{"0o17", token.INT, "0o17"},
+		{"0b1010", token.INT, "0b1010"},
+		{"3.14", token.FLOAT, "3.14"},
+		{"1e10", token.FLOAT, "1e10"},
+		{"2.5E-3", token.FLOAT, "2.5E-3"},
+		{"1_000.000_1", token.FLOAT, "1_000.000_1"},
+		{"0x", token.ILLEGAL, "0x"},
+		{"0b102", token.ILLEGAL, "0b102"},
+		{"0xZZ", token.ILLEGAL, "0xZZ"},
+		{"1__0", token.ILLEGAL, "1__0"},
+		{"1_", token.ILLEGAL, "1_"},
+		{"1e", token.ILLEGAL, "1e"},
+		{"1.5e+", token.ILLEGAL, "1.5e+"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] failed. expected %q, got %q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] failed, expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("tests[%d] failed, expected EOF after the number, got %q %q", i, next.Type, next.Literal)
+		}
+		if tok.Type == token.ILLEGAL && len(l.Errors()) != 1 {
+			t.Errorf("tests[%d] failed, expected 1 error, got %v", i, l.Errors())
+		}
+	}
+}
+
+func TestNumberErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedErr string
+	}{
+		{"0x", "1:3: hexadecimal literal has no digits"},
+		{"0b102", "1:1: invalid digit '2' in binary literal"},
+		{"1__0", "1:3: '_' must separate successive digits"},
+		{"1e", "1:1: exponent has no digits"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		l.NextToken()
+		errs := l.Errors()
+		if len(errs) != 1 {
+			t.Fatalf("tests[%d] failed, expected 1 error, got %v", i, errs)
+		}
+		if errs[0].Error() != tt.expectedErr {
+			t.Errorf("tests[%d] failed, expected %q, got %q", i, tt.expectedErr, errs[0].Error())
+		}
+	}
+}
+
+func TestCompoundOperators(t *testing.T) {
+	input := `a <= b >= c && d || e % f ** g += 1 -= 2 * 3 & |`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.AND, "&&"},
+		{token.IDENT, "d"},
+		{token.OR, "||"},
+		{token.IDENT, "e"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "f"},
+		{token.POWER, "**"},
+		{token.IDENT, "g"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.ASTERISK, "*"},
+		{token.INT, "3"},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.EOF, "\x00"},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] failed. expected %q %q, got %q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+	if errs := l.Errors(); len(errs) != 2 || errs[0].Msg != "illegal character '&', did you mean &&?" {
+		t.Errorf("expected errors for the single & and |, got %v", errs)
+	}
+}
@@ -0,0 +1,133 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+// number literals:
+//
+//	decimal   123  1_000_000  (0755 is an error, it is 0o755 or 755)
+//	prefixed  0xFF  0o17  0b1010  0xdead_beef
+//	float     3.14  1e10  2.5E-3  1_000.000_1
+//
+// an underscore may only sit between two digits. the token literal is the raw
+// source text, the parser resolves the value.
+
+var numberBases = map[rune]struct {
+	base int
+	name string
+}{
+	'x': {16, "hexadecimal"},
+	'X': {16, "hexadecimal"},
+	'o': {8, "octal"},
+	'O': {8, "octal"},
+	'b': {2, "binary"},
+	'B': {2, "binary"},
+}
+
+// readNumber reads the number starting at the current char. a malformed
+// number gives an ILLEGAL token holding the raw source.
+func (l *Lexer) readNumber() token.Token {
+	start := l.pos()
+	valid := true
+	invalid := func(pos token.Position, format string, args ...interface{}) {
+		if valid {
+			l.errorf(pos, format, args...)
+		}
+		valid = false
+	}
+
+	tokType := token.TokenType(token.INT)
+	if prefix, ok := numberBases[l.peekChar()]; ok && l.ch == '0' {
+		l.readChar()
+		l.readChar()
+		// read every letter and digit, so `0b102` or `0xZZ` is one bad
+		// token instead of a number followed by an identifier
+		digitsStart := l.pos()
+		if !l.readDigits(func(ch rune) bool { return isNumber(ch) || isLetter(ch) }, invalid) {
+			invalid(digitsStart, "%s literal has no digits", prefix.name)
+		}
+		for _, ch := range l.textBetween(digitsStart.Offset, l.position) {
+			if ch != '_' && digitValue(ch) >= prefix.base {
+				invalid(start, "invalid digit %q in %s literal", ch, prefix.name)
+			}
+		}
+	} else {
+		l.readDigits(isNumber, invalid)
+		if l.ch == '.' && isNumber(l.peekChar()) {
+			tokType = token.FLOAT
+			l.readChar()
+			l.readDigits(isNumber, invalid)
+		}
+		if l.ch == 'e' || l.ch == 'E' {
+			tokType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			if !l.readDigits(isNumber, invalid) {
+				invalid(start, "exponent has no digits")
+			}
+		}
+	}
+
+	literal := l.textBetween(start.Offset, l.position)
+	// 0755 was octal once, so rather than quietly read it as decimal it is
+	// an error that says which one to write
+	if tokType == token.INT && len(literal) > 1 && literal[0] == '0' && (isNumber(rune(literal[1])) || literal[1] == '_') {
+		invalid(start, "%s", leadingZeroMessage(literal))
+	}
+	if !valid {
+		return token.Token{Type: token.ILLEGAL, Literal: literal}
+	}
+	return token.Token{Type: tokType, Literal: literal}
+}
+
+func leadingZeroMessage(literal string) string {
+	decimal := strings.TrimLeft(literal, "0_")
+	if decimal == "" {
+		decimal = "0"
+	}
+	if strings.ContainsAny(literal, "89") {
+		return fmt.Sprintf("leading zero in %s, write %s for a decimal literal", literal, decimal)
+	}
+	return fmt.Sprintf("leading zero in %s, write 0o%s for an octal or %s for a decimal literal", literal, decimal, decimal)
+}
+
+// readDigits reads a run of digits separated by single underscores and
+// reports whether there was at least one digit
+func (l *Lexer) readDigits(isDigit func(rune) bool, invalid func(token.Position, string, ...interface{})) bool {
+	digits := 0
+	lastUnderscore := false
+	for isDigit(l.ch) || l.ch == '_' {
+		if l.ch == '_' {
+			if digits == 0 || lastUnderscore {
+				invalid(l.pos(), "'_' must separate successive digits")
+			}
+			lastUnderscore = true
+		} else {
+			digits++
+			lastUnderscore = false
+		}
+		l.readChar()
+	}
+	if lastUnderscore {
+		invalid(l.pos(), "'_' must separate successive digits")
+	}
+	return digits > 0
+}
+
+// digitValue is the value of a digit in bases up to 36, or 36 for anything else
+func digitValue(ch rune) int {
+	switch {
+	case isNumber(ch):
+		return int(ch - '0')
+	case 'a' <= unicode.ToLower(ch) && unicode.ToLower(ch) <= 'z':
+		return int(unicode.ToLower(ch)-'a') + 10
+	}
+	return 36
+}
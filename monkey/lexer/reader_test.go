@@ -0,0 +1,116 @@
+package lexer
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+func TestReaderMatchesString(t *testing.T) {
+	input := `// comment
+let café = fn(x, y) { x + y * 0xFF_FF; };
+/* block
+   comment */ let s = "multi
+line \u{1F600} \"quoted\"";
+if (3.14 != 1e3) { return true; } else { return "日本"; }
+"unterminated \xff`
+
+	readers := map[string]func() *Lexer{
+		"reader":      func() *Lexer { return NewFileReader("test.monkey", strings.NewReader(input)) },
+		"one byte":    func() *Lexer { return NewFileReader("test.monkey", iotest.OneByteReader(strings.NewReader(input))) },
+		"half reader": func() *Lexer { return NewFileReader("test.monkey", iotest.HalfReader(strings.NewReader(input))) },
+	}
+
+	for name, newLexer := range readers {
+		for _, mode := range []Mode{0, KeepComments} {
+			expected := NewFile("test.monkey", input)
+			actual := newLexer()
+			expected.SetMode(mode)
+			actual.SetMode(mode)
+
+			for i := 0; ; i++ {
+				want := expected.NextToken()
+				got := actual.NextToken()
+				if !sameToken(want, got) {
+					t.Fatalf("%s mode %d token %d: expected %+v, got %+v", name, mode, i, want, got)
+				}
+				if want.Type == token.EOF {
+					break
+				}
+			}
+			if len(expected.Errors()) != len(actual.Errors()) {
+				t.Fatalf("%s: expected errors %v, got %v", name, expected.Errors(), actual.Errors())
+			}
+			for i := range expected.Errors() {
+				if *expected.Errors()[i] != *actual.Errors()[i] {
+					t.Errorf("%s: expected error %v, got %v", name, expected.Errors()[i], actual.Errors()[i])
+				}
+			}
+		}
+	}
+}
+
+func sameToken(a, b token.Token) bool {
+	if a.Type != b.Type || a.Literal != b.Literal || a.Pos != b.Pos || a.End != b.End {
+		return false
+	}
+	if len(a.Comments) != len(b.Comments) {
+		return false
+	}
+	for i := range a.Comments {
+		if a.Comments[i] != b.Comments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// failingReader gives its data and then fails, on every read after that or,
+// with once set, on the first one only and then it is at EOF
+type failingReader struct {
+	data   string
+	once   bool
+	done   bool
+	failed bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if !r.done {
+		r.done = true
+		return copy(p, r.data), nil
+	}
+	if r.once && r.failed {
+		return 0, io.EOF
+	}
+	r.failed = true
+	return 0, errors.New("disk on fire")
+}
+
+func TestReaderError(t *testing.T) {
+	tests := []struct {
+		reader   *failingReader
+		expected []token.TokenType
+		err      string
+	}{
+		{&failingReader{data: "let x"}, []token.TokenType{token.LET, token.IDENT, token.EOF}, "1:6: read error: disk on fire"},
+		// the = peeks for ==, which is where the only failing read happens
+		{&failingReader{data: "x =", once: true}, []token.TokenType{token.IDENT, token.ASSIGN, token.EOF}, "1:4: read error: disk on fire"},
+	}
+
+	for _, tt := range tests {
+		l := NewReader(tt.reader)
+		for i, expected := range tt.expected {
+			if tok := l.NextToken(); tok.Type != expected {
+				t.Fatalf("%q token %d: expected %q, got %q", tt.reader.data, i, expected, tok.Type)
+			}
+		}
+		errs := l.Errors()
+		if len(errs) != 1 || errs[0].Error() != tt.err {
+			t.Errorf("%q: expected a read error, got %v", tt.reader.data, errs)
+		}
+	}
+}
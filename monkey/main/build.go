@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/compiler"
+	"github.com/fandan-nyc/all-interpretors/monkey/mkc"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+	"github.com/fandan-nyc/all-interpretors/monkey/vm"
+)
+
+// buildFile compiles a script to a .mkc file next to it, and returns the exit code
+func buildFile(path string, errOut io.Writer) int {
+	program, ok := parseFile(path, errOut)
+	if !ok {
+		return 1
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+
+	f, err := os.Create(strings.TrimSuffix(path, filepath.Ext(path)) + ".mkc")
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	err = mkc.Encode(f, comp.Bytecode())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	return 0
+}
+
+// runCompiledFile runs a .mkc file on the vm, and returns the exit code
+func runCompiledFile(path string, out, errOut io.Writer) int {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	bytecode, err := mkc.Decode(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		if errObj, ok := err.(*object.Error); ok {
+			fmt.Fprintln(errOut, errObj.Trace())
+		} else {
+			fmt.Fprintln(errOut, err)
+		}
+		return 1
+	}
+	if result := machine.LastPoppedStackElem(); result != nil && result != object.NULL {
+		fmt.Fprintln(out, result.Inspect())
+	}
+	return 0
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/compiler"
+	"github.com/fandan-nyc/all-interpretors/monkey/disasm"
+)
+
+// disasmFile compiles a script and lists its bytecode, and returns the exit code
+func disasmFile(path string, out, errOut io.Writer) int {
+	program, ok := parseFile(path, errOut)
+	if !ok {
+		return 1
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	fmt.Fprint(out, disasm.Disassemble(comp.Bytecode()))
+	return 0
+}
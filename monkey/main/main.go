@@ -7,7 +7,27 @@ import (
 	"os/user"
 )
 
+// usage:
+//
+//	monkey              start the REPL
+//	monkey file.monkey  run a script
+//	monkey -            run a script from stdin
+//	monkey file.mkc     run a compiled script on the vm
+//	monkey build file.monkey
+//	                    compile the script to file.mkc
+//	monkey disasm file.monkey
+//	                    list the bytecode the script compiles to
 func main() {
+	if len(os.Args) > 2 && os.Args[1] == "build" {
+		os.Exit(buildFile(os.Args[2], os.Stderr))
+	}
+	if len(os.Args) > 2 && os.Args[1] == "disasm" {
+		os.Exit(disasmFile(os.Args[2], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 {
+		os.Exit(runFile(os.Args[1], os.Stdout, os.Stderr))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/ast"
+	"github.com/fandan-nyc/all-interpretors/monkey/evaluator"
+	"github.com/fandan-nyc/all-interpretors/monkey/lexer"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+	"github.com/fandan-nyc/all-interpretors/monkey/parser"
+)
+
+// runFile runs a script, or stdin when path is "-", and returns the exit code.
+// the script is lexed as it is read, so it never has to fit in memory as a whole.
+func runFile(path string, out, errOut io.Writer) int {
+	if filepath.Ext(path) == ".mkc" {
+		return runCompiledFile(path, out, errOut)
+	}
+	program, ok := parseFile(path, errOut)
+	if !ok {
+		return 1
+	}
+
+	evaluated := evaluator.Eval(program, object.NewEnvironment())
+	if errObj, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintln(errOut, errObj.Trace())
+		return 1
+	}
+	if evaluated != nil && evaluated != evaluator.NULL {
+		fmt.Fprintln(out, evaluated.Inspect())
+	}
+	return 0
+}
+
+// parseFile parses a script, or stdin when path is "-". it reports any
+// problem to errOut.
+func parseFile(path string, errOut io.Writer) (*ast.Program, bool) {
+	name := path
+	var in io.Reader = os.Stdin
+	if path == "-" {
+		name = "<stdin>"
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return nil, false
+		}
+		defer f.Close()
+		in = f
+	}
+
+	p := parser.New(lexer.NewFileReader(name, in))
+	program := p.ParseProgram()
+	if errs := p.ParseErrors(); len(errs) != 0 {
+		printParseErrors(errOut, path, errs)
+		return nil, false
+	}
+	return program, true
+}
+
+// the source is only read again when there is something to show from it,
+// stdin cannot be read twice so it gets the errors without the source lines
+func printParseErrors(errOut io.Writer, path string, errs parser.ErrorList) {
+	if path != "-" {
+		if src, err := ioutil.ReadFile(path); err == nil {
+			fmt.Fprintln(errOut, errs.Render(string(src)))
+			return
+		}
+	}
+	for _, e := range errs {
+		fmt.Fprintln(errOut, e.Error())
+	}
+}
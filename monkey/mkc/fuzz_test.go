@@ -0,0 +1,107 @@
+//go:build go1.18
+// +build go1.18
+
+package mkc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/code"
+	"github.com/fandan-nyc/all-interpretors/monkey/compiler"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+	"github.com/fandan-nyc/all-interpretors/monkey/vm"
+)
+
+var fuzzSeeds = []string{
+	"1 + 2.5",
+	`let h = {"a": [1, "two"]}; h["a"][0] += 1; h`,
+	"let adder = fn(a) { fn(b) { a + b } }; adder(1)(2)",
+	"let s = 0; for (x in [1, 2, 3]) { if (x == 2) { continue; } s += x }; s",
+	"let i = 0; while (i < 3) { i = i + 1 }",
+	`try { throw "no" } catch (e) { e["message"] } finally { len("x") }`,
+}
+
+func addSeeds(f *testing.F) {
+	for _, input := range fuzzSeeds {
+		var buf bytes.Buffer
+		if err := Encode(&buf, compile(f, "seed.monkey", input)); err != nil {
+			f.Fatalf("encode failed for %q: %s", input, err)
+		}
+		f.Add(buf.Bytes())
+	}
+}
+
+// a corrupt file is an error, never a panic, and neither is running what
+// decodes
+func FuzzDecode(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bytecode, err := Decode(bytes.NewReader(data))
+		if err == nil {
+			roundTripFuzz(t, bytecode)
+			runFuzz(bytecode)
+		}
+	})
+}
+
+// almost every mutation breaks the checksum, so this one fixes it up first
+// to get the fuzzer past it into the rest of the decoder
+func FuzzDecodeBody(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bytecode, err := Decode(bytes.NewReader(reseal(data)))
+		if err == nil {
+			roundTripFuzz(t, bytecode)
+			runFuzz(bytecode)
+		}
+	})
+}
+
+// whatever decodes has to encode to something that decodes the same
+func roundTripFuzz(t *testing.T, bytecode *compiler.Bytecode) {
+	var first, second bytes.Buffer
+	if err := Encode(&first, bytecode); err != nil {
+		t.Fatalf("encode of decoded bytecode failed: %s", err)
+	}
+	decoded, err := Decode(bytes.NewReader(first.Bytes()))
+	if err != nil {
+		t.Fatalf("decode of encoded bytecode failed: %s", err)
+	}
+	if err := Encode(&second, decoded); err != nil {
+		t.Fatalf("second encode failed: %s", err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatalf("encoding is not stable")
+	}
+}
+
+// runFuzz runs bytecode on the vm, where an error is fine and a panic fails
+// the fuzzer. a jump backwards can loop forever, so only bytecode without
+// one runs. calls still nest, but end in a stack overflow at worst.
+func runFuzz(bytecode *compiler.Bytecode) {
+	if !jumpsForward(bytecode.Instructions) {
+		return
+	}
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok && !jumpsForward(fn.Instructions) {
+			return
+		}
+	}
+	vm.New(bytecode).Run()
+}
+
+func jumpsForward(ins code.Instructions) bool {
+	for i := 0; i < len(ins); {
+		def, _ := code.Lookup(ins[i])
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		switch code.Opcode(ins[i]) {
+		case code.OpJump, code.OpJumpNotTruthy, code.OpIterNext, code.OpTry:
+			if operands[0] <= i {
+				return false
+			}
+		}
+		i += 1 + read
+	}
+	return true
+}
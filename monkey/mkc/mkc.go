@@ -0,0 +1,613 @@
+// Package mkc writes compiled programs to .mkc files and reads them back,
+// so a script can be compiled once and the bytecode shipped and run as is.
+//
+// a file is laid out as:
+//
+//	magic      "MKC\x00"
+//	version    uint16
+//	main       the top level, as a function
+//	globals    count, then the names
+//	constants  count, then each as a kind byte and its value
+//	checksum   CRC-32 (IEEE) of everything before it, uint32
+//
+// a function is its name, number of parameters, number of locals, local
+// names, free names, instructions, line table and the source it prints as.
+// a line table is the file its positions are in, then count entries of
+// instruction offset, source offset, line and column.
+//
+// fixed size numbers are big endian like the operands in the instructions,
+// every other number is a varint and strings and byte slices are their length
+// followed by the bytes.
+package mkc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/code"
+	"github.com/fandan-nyc/all-interpretors/monkey/compiler"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+const Magic = "MKC\x00"
+
+// Version changes whenever the layout or the instruction set does, files of
+// any other version are refused rather than run with the wrong meaning
+const Version = 1
+
+const (
+	headerSize   = len(Magic) + 2
+	checksumSize = 4
+
+	// OpGetLocal and friends have a one byte operand
+	maxLocals = 256
+)
+
+// kinds of constants
+const (
+	constInteger byte = iota + 1
+	constFloat
+	constString
+	constFunction
+)
+
+var (
+	ErrMagic    = errors.New("mkc: not a compiled monkey file")
+	ErrChecksum = errors.New("mkc: checksum mismatch, the file is corrupt")
+)
+
+// VersionError is returned for a file written for another version of the
+// format
+type VersionError struct {
+	Version int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("mkc: unsupported version %d, want %d", e.Version, Version)
+}
+
+// Encode writes bytecode as a .mkc file
+func Encode(w io.Writer, bytecode *compiler.Bytecode) error {
+	e := &encoder{}
+	e.buf.WriteString(Magic)
+	e.uint16(Version)
+
+	main := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Lines:        bytecode.Lines,
+		NumLocals:    bytecode.NumLocals,
+		LocalNames:   bytecode.LocalNames,
+	}
+	if err := e.function(main); err != nil {
+		return err
+	}
+	e.strings(bytecode.GlobalNames)
+
+	e.uvarint(uint64(len(bytecode.Constants)))
+	for i, constant := range bytecode.Constants {
+		if err := e.constant(constant); err != nil {
+			return fmt.Errorf("mkc: constant %d: %s", i, err)
+		}
+	}
+
+	e.uint32(crc32.ChecksumIEEE(e.buf.Bytes()))
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+type encoder struct {
+	buf     bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) uint16(v uint16) {
+	binary.BigEndian.PutUint16(e.scratch[:], v)
+	e.buf.Write(e.scratch[:2])
+}
+
+func (e *encoder) uint32(v uint32) {
+	binary.BigEndian.PutUint32(e.scratch[:], v)
+	e.buf.Write(e.scratch[:4])
+}
+
+func (e *encoder) uint64(v uint64) {
+	binary.BigEndian.PutUint64(e.scratch[:], v)
+	e.buf.Write(e.scratch[:8])
+}
+
+func (e *encoder) uvarint(v uint64) {
+	n := binary.PutUvarint(e.scratch[:], v)
+	e.buf.Write(e.scratch[:n])
+}
+
+func (e *encoder) varint(v int64) {
+	n := binary.PutVarint(e.scratch[:], v)
+	e.buf.Write(e.scratch[:n])
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) strings(ss []string) {
+	e.uvarint(uint64(len(ss)))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(constInteger)
+		e.varint(obj.Value)
+	case *object.Float:
+		e.buf.WriteByte(constFloat)
+		e.uint64(math.Float64bits(obj.Value))
+	case *object.String:
+		e.buf.WriteByte(constString)
+		e.string(obj.Value)
+	case *object.CompiledFunction:
+		e.buf.WriteByte(constFunction)
+		return e.function(obj)
+	default:
+		return fmt.Errorf("cannot encode %s", obj.Type())
+	}
+	return nil
+}
+
+func (e *encoder) function(fn *object.CompiledFunction) error {
+	e.string(fn.Name)
+	e.uvarint(uint64(fn.NumParameters))
+	e.uvarint(uint64(fn.NumLocals))
+	e.strings(fn.LocalNames)
+	e.strings(fn.FreeNames)
+	e.bytes(fn.Instructions)
+	if err := e.lines(fn.Lines); err != nil {
+		return err
+	}
+	e.string(fn.Source)
+	return nil
+}
+
+// the positions of one function all come from the same file, so the name is
+// written once. entries without a position keep their zero line.
+func (e *encoder) lines(lt code.LineTable) error {
+	filename := ""
+	for _, entry := range lt {
+		if !entry.Pos.IsValid() {
+			continue
+		}
+		if filename == "" {
+			filename = entry.Pos.Filename
+		} else if entry.Pos.Filename != filename {
+			return fmt.Errorf("mkc: positions from both %q and %q in one function", filename, entry.Pos.Filename)
+		}
+	}
+
+	e.string(filename)
+	e.uvarint(uint64(len(lt)))
+	for _, entry := range lt {
+		pos := entry.Pos
+		if !pos.IsValid() {
+			pos = token.Position{}
+		}
+		e.uvarint(uint64(entry.Offset))
+		e.uvarint(uint64(pos.Offset))
+		e.uvarint(uint64(pos.Line))
+		e.uvarint(uint64(pos.Column))
+	}
+	return nil
+}
+
+// Decode reads a .mkc file. the file is checked as a whole before any of it
+// is used: a wrong version, a bad checksum or bytecode the compiler would not
+// have made is an error, see validate. what validate cannot see, the type of
+// the value an OpIterNext or OpClosure finds on the stack, the vm checks as
+// it runs.
+func Decode(r io.Reader) (*compiler.Bytecode, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(Magic) || string(data[:len(Magic)]) != Magic {
+		return nil, ErrMagic
+	}
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("mkc: file too short")
+	}
+	if version := binary.BigEndian.Uint16(data[len(Magic):]); version != Version {
+		return nil, &VersionError{Version: int(version)}
+	}
+	if len(data) < headerSize+checksumSize {
+		return nil, fmt.Errorf("mkc: file too short")
+	}
+	body, sum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return nil, ErrChecksum
+	}
+
+	d := &decoder{data: body, pos: headerSize}
+	main := d.function()
+	globalNames := d.strings()
+	constants := make([]object.Object, d.count())
+	for i := range constants {
+		constants[i] = d.constant()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("mkc: %d bytes left over", len(d.data)-d.pos)
+	}
+
+	if err := validate("<main>", main, constants, true); err != nil {
+		return nil, err
+	}
+	for i, constant := range constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			if err := validate(fmt.Sprintf("constant %d", i), fn, constants, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &compiler.Bytecode{
+		Instructions: main.Instructions,
+		Lines:        main.Lines,
+		Constants:    constants,
+		NumLocals:    main.NumLocals,
+		LocalNames:   main.LocalNames,
+		GlobalNames:  globalNames,
+	}, nil
+}
+
+// decoder keeps the first error and reads zeros after it, so the reading
+// code can check once at the end
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("mkc: offset %d: %s", d.pos, fmt.Sprintf(format, a...))
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.data) {
+		d.fail("unexpected end of file")
+		return 0
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data)-d.pos < 8 {
+		d.fail("unexpected end of file")
+		return 0
+	}
+	v := binary.BigEndian.Uint64(d.data[d.pos:])
+	d.pos += 8
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("bad number")
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("bad number")
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+// int reads a number that has to fit an int on any platform
+func (d *decoder) int() int {
+	v := d.uvarint()
+	if v > math.MaxInt32 {
+		d.fail("number %d too large", v)
+		return 0
+	}
+	return int(v)
+}
+
+// count reads a number of things still to come. each takes at least a byte,
+// so a count larger than what is left is corrupt, and checking it keeps a bad
+// file from making us allocate a lot.
+func (d *decoder) count() int {
+	v := d.uvarint()
+	if v > uint64(len(d.data)-d.pos) {
+		d.fail("count %d past the end of the file", v)
+		return 0
+	}
+	return int(v)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	b := make([]byte, n)
+	copy(b, d.data[d.pos:])
+	d.pos += n
+	return b
+}
+
+func (d *decoder) string() string {
+	n := d.count()
+	s := string(d.data[d.pos : d.pos+n])
+	d.pos += n
+	return s
+}
+
+func (d *decoder) strings() []string {
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+	ss := make([]string, n)
+	for i := range ss {
+		ss[i] = d.string()
+	}
+	return ss
+}
+
+func (d *decoder) constant() object.Object {
+	switch kind := d.byte(); kind {
+	case constInteger:
+		return &object.Integer{Value: d.varint()}
+	case constFloat:
+		return &object.Float{Value: math.Float64frombits(d.uint64())}
+	case constString:
+		return &object.String{Value: d.string()}
+	case constFunction:
+		return d.function()
+	default:
+		d.fail("unknown constant kind %d", kind)
+		return nil
+	}
+}
+
+func (d *decoder) function() *object.CompiledFunction {
+	fn := &object.CompiledFunction{}
+	fn.Name = d.string()
+	fn.NumParameters = d.int()
+	fn.NumLocals = d.int()
+	fn.LocalNames = d.strings()
+	fn.FreeNames = d.strings()
+	fn.Instructions = d.bytes()
+	fn.Lines = d.lines()
+	fn.Source = d.string()
+	return fn
+}
+
+func (d *decoder) lines() code.LineTable {
+	filename := d.string()
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+	lt := make(code.LineTable, n)
+	for i := range lt {
+		lt[i].Offset = d.int()
+		pos := token.Position{Offset: d.int(), Line: d.int(), Column: d.int()}
+		if pos.IsValid() {
+			pos.Filename = filename
+		}
+		lt[i].Pos = pos
+	}
+	return lt
+}
+
+// validate checks what the vm takes on trust from the compiler: that every
+// instruction is whole and known, operands refer to constants, locals, free
+// variables and builtins that exist, and jumps land on an instruction. it
+// then follows every path through the function, see checkFlow.
+func validate(name string, fn *object.CompiledFunction, constants []object.Object, isMain bool) error {
+	fail := func(format string, a ...interface{}) error {
+		return fmt.Errorf("mkc: %s: %s", name, fmt.Sprintf(format, a...))
+	}
+
+	if fn.NumLocals > maxLocals {
+		return fail("%d locals, at most %d", fn.NumLocals, maxLocals)
+	}
+	if fn.NumParameters > fn.NumLocals {
+		return fail("%d parameters but %d locals", fn.NumParameters, fn.NumLocals)
+	}
+	if len(fn.LocalNames) > fn.NumLocals {
+		return fail("%d local names but %d locals", len(fn.LocalNames), fn.NumLocals)
+	}
+	for i := 1; i < len(fn.Lines); i++ {
+		if fn.Lines[i].Offset < fn.Lines[i-1].Offset {
+			return fail("line table out of order")
+		}
+	}
+
+	ins := fn.Instructions
+	decoded := make(map[int]instruction)
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return fail("offset %d: %s", i, err)
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return fail("offset %d: %s is cut short", i, def.Name)
+		}
+		operands, _ := code.ReadOperands(def, ins[i+1:])
+
+		var bad bool
+		switch code.Opcode(ins[i]) {
+		case code.OpConstant:
+			bad = operands[0] >= len(constants)
+		case code.OpClosure:
+			bad = operands[0] >= len(constants)
+			if !bad {
+				target, isFn := constants[operands[0]].(*object.CompiledFunction)
+				bad = !isFn || operands[1] != len(target.FreeNames)
+			}
+		case code.OpGetLocal, code.OpSetLocal, code.OpGetCell, code.OpSetCell, code.OpLoadCell, code.OpResetLocal:
+			bad = operands[0] >= fn.NumLocals
+		case code.OpGetFree, code.OpSetFree, code.OpLoadFree:
+			bad = operands[0] >= len(fn.FreeNames)
+		case code.OpGetBuiltin:
+			bad = operands[0] >= len(object.Builtins)
+		case code.OpHash:
+			bad = operands[0]%2 != 0
+		case code.OpSetIndex:
+			op := code.Opcode(operands[0])
+			bad = op != 0 && op != code.OpAdd && op != code.OpSub
+		}
+		if bad {
+			return fail("offset %d: bad operand for %s", i, def.Name)
+		}
+
+		decoded[i] = instruction{def: def, op: code.Opcode(ins[i]), operands: operands, next: i + 1 + width}
+		i += 1 + width
+	}
+	for i, in := range decoded {
+		switch in.op {
+		case code.OpJump, code.OpJumpNotTruthy, code.OpIterNext, code.OpTry:
+			if target := in.operands[0]; target != len(ins) {
+				if _, ok := decoded[target]; !ok {
+					return fail("offset %d: jump to %d, which is not an instruction", i, target)
+				}
+			}
+		}
+	}
+
+	if err := checkFlow(decoded, len(ins), isMain); err != nil {
+		return fail("%s", err)
+	}
+	return nil
+}
+
+type instruction struct {
+	def      *code.Definition
+	op       code.Opcode
+	operands []int
+	next     int // the offset of the instruction after it
+}
+
+// flowState is what the vm has on hand before an instruction: the values
+// on the stack above the locals, and the try blocks started and not ended
+type flowState struct {
+	depth int
+	tries int
+}
+
+// checkFlow follows every path through the instructions, so that no
+// instruction takes more values off the stack than there are and no
+// OpEndTry ends a try block that was not started. every path that reaches
+// an instruction has to get there in the same state, which makes one visit
+// of each instruction enough. only the top level may run off its end, a
+// function has to return.
+func checkFlow(decoded map[int]instruction, end int, isMain bool) error {
+	states := make(map[int]flowState)
+	var work []int
+	reach := func(from, target int, state flowState) error {
+		if target == end {
+			if !isMain {
+				return fmt.Errorf("offset %d: runs past the end of the function", from)
+			}
+			return nil
+		}
+		if seen, ok := states[target]; ok {
+			if seen != state {
+				return fmt.Errorf("offset %d: reached with %d values and %d try blocks, and with %d and %d",
+					target, seen.depth, seen.tries, state.depth, state.tries)
+			}
+			return nil
+		}
+		states[target] = state
+		work = append(work, target)
+		return nil
+	}
+
+	if err := reach(0, 0, flowState{}); err != nil {
+		return err
+	}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		in, state := decoded[i], states[i]
+
+		pops, pushes := code.StackEffect(in.op, in.operands)
+		if state.depth < pops {
+			return fmt.Errorf("offset %d: %s needs %d on the stack, has %d", i, in.def.Name, pops, state.depth)
+		}
+		next := flowState{depth: state.depth - pops + pushes, tries: state.tries}
+
+		var err error
+		fallsThrough := true
+		switch in.op {
+		case code.OpJump:
+			err = reach(i, in.operands[0], next)
+			fallsThrough = false
+		case code.OpReturnValue, code.OpReturn, code.OpThrow:
+			fallsThrough = false
+		case code.OpJumpNotTruthy:
+			err = reach(i, in.operands[0], next)
+		case code.OpIterNext:
+			// when the iterator is done nothing is pushed
+			err = reach(i, in.operands[0], flowState{depth: next.depth - 1, tries: next.tries})
+		case code.OpTry:
+			// the handler gets the stack as it is here, plus the error
+			err = reach(i, in.operands[0], flowState{depth: state.depth + 1, tries: state.tries})
+			next.tries++
+		case code.OpEndTry:
+			if state.tries == 0 {
+				return fmt.Errorf("offset %d: OpEndTry outside of a try block", i)
+			}
+			next.tries--
+		}
+		if err == nil && fallsThrough {
+			err = reach(i, in.next, next)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package mkc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/code"
+	"github.com/fandan-nyc/all-interpretors/monkey/compiler"
+	"github.com/fandan-nyc/all-interpretors/monkey/disasm"
+	"github.com/fandan-nyc/all-interpretors/monkey/lexer"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+	"github.com/fandan-nyc/all-interpretors/monkey/parser"
+	"github.com/fandan-nyc/all-interpretors/monkey/vm"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "3"},
+		{"1.5 * 2", "3.0"},
+		{`"mon" + "key"`, "monkey"},
+		{"let x = 5; x = x - 1; x", "4"},
+		{`let h = {"a": [1, 2]}; h["a"][1] += 40; h["a"][1]`, "42"},
+		{"let adder = fn(a) { fn(b) { a + b } }; adder(1)(2)", "3"},
+		{"let f = fn() { let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(10) }; f()", "true"},
+		{"let s = 0; for (x in [1, 2, 3]) { if (x == 2) { continue; } s += x }; s", "4"},
+		{`try { throw "no" } catch (e) { e["message"] + "!" }`, "no!"},
+		{"len(rest([1, 2, 3]))", "2"},
+		{"let x = 1;", "null"},
+		{"fn(x) { x }", "fn(x) {\nx\n}"},
+	}
+
+	for _, tt := range tests {
+		bytecode := compile(t, "test.monkey", tt.input)
+		decoded := roundTrip(t, bytecode)
+
+		if got, want := disasm.Disassemble(decoded), disasm.Disassemble(bytecode); got != want {
+			t.Errorf("decoded bytecode differs for %q.\nwant=\n%s\ngot=\n%s", tt.input, want, got)
+		}
+
+		machine := vm.New(decoded)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if got := machine.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestRoundTripKeepsPositions(t *testing.T) {
+	input := `let f = fn(x) {
+  x / 0
+};
+f(1)`
+	decoded := roundTrip(t, compile(t, "div.monkey", input))
+
+	err := vm.New(decoded).Run()
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("expected an *object.Error, got=%T (%v)", err, err)
+	}
+	expected := "ERROR: division by zero\n\nf()\n\tdiv.monkey:2:3\n<main>\n\tdiv.monkey:4:1"
+	if errObj.Trace() != expected {
+		t.Errorf("wrong trace.\nwant=\n%s\ngot=\n%s", expected, errObj.Trace())
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, compile(t, "", "let f = fn(a) { a + 1 }; f(2)")); err != nil {
+		t.Fatalf("encode failed: %s", err)
+	}
+	valid := buf.Bytes()
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", nil, "not a compiled monkey file"},
+		{"source file", []byte("let x = 1;"), "not a compiled monkey file"},
+		{"header only", valid[:headerSize], "file too short"},
+		{"newer version", withVersion(valid, Version+1), "unsupported version 2, want 1"},
+		{"truncated", valid[:len(valid)-1], "checksum mismatch"},
+		{"flipped bit", flip(valid, len(valid)/2), "checksum mismatch"},
+		{"trailing byte", seal(append(withoutChecksum(valid), 0)), "bytes left over"},
+		{"unknown opcode", reseal(replace(valid, 0, 255)), "opcode 255 undefined"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+
+	_, err := Decode(bytes.NewReader(withVersion(valid, 0)))
+	if verr, ok := err.(*VersionError); !ok || verr.Version != 0 {
+		t.Errorf("expected a *VersionError for version 0, got=%T (%v)", err, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	fn := func(ins ...[]byte) *compiler.Bytecode {
+		return &compiler.Bytecode{
+			Instructions: concat(ins...),
+			Constants:    []object.Object{&object.Integer{Value: 1}},
+		}
+	}
+
+	tests := []struct {
+		bytecode *compiler.Bytecode
+		expected string
+	}{
+		{fn([]byte{byte(code.OpConstant)}), "OpConstant is cut short"},
+		{fn(code.Make(code.OpConstant, 1)), "bad operand for OpConstant"},
+		{fn(code.Make(code.OpClosure, 0, 0)), "bad operand for OpClosure"},
+		{fn(code.Make(code.OpGetLocal, 0)), "bad operand for OpGetLocal"},
+		{fn(code.Make(code.OpGetBuiltin, 200)), "bad operand for OpGetBuiltin"},
+		{fn(code.Make(code.OpJump, 1)), "jump to 1, which is not an instruction"},
+		{fn(code.Make(code.OpNull), code.Make(code.OpHash, 1)), "bad operand for OpHash"},
+		{&compiler.Bytecode{NumLocals: 300}, "300 locals, at most 256"},
+		{fn(code.Make(code.OpPop)), "OpPop needs 1 on the stack, has 0"},
+		{fn(code.Make(code.OpTrue), code.Make(code.OpAdd)), "OpAdd needs 2 on the stack, has 1"},
+		{fn(code.Make(code.OpEndTry)), "OpEndTry outside of a try block"},
+		{fn(code.Make(code.OpTry, 5), code.Make(code.OpEndTry), code.Make(code.OpEndTry)), "OpEndTry outside of a try block"},
+		{fn(code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 5), code.Make(code.OpTrue), code.Make(code.OpPop)),
+			"offset 5: reached with 0 values and 0 try blocks, and with 1 and 0"},
+		{withFunction(fn(code.Make(code.OpClosure, 1, 0)), &object.CompiledFunction{
+			Instructions: code.Make(code.OpReturn),
+			FreeNames:    []string{"x"},
+		}), "bad operand for OpClosure"},
+		{withFunction(fn(), &object.CompiledFunction{
+			Instructions: code.Make(code.OpNull),
+		}), "constant 1: offset 0: runs past the end of the function"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := Encode(&buf, tt.bytecode); err != nil {
+			t.Fatalf("encode failed: %s", err)
+		}
+		_, err := Decode(&buf)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+// some bytecode gets past Decode, as only the vm knows the type of what
+// is on the stack. it has to be an error there, not a panic.
+func TestRunInvalid(t *testing.T) {
+	captures := &object.CompiledFunction{
+		Instructions: code.Make(code.OpReturn),
+		FreeNames:    []string{"x"},
+	}
+	tests := []struct {
+		bytecode *compiler.Bytecode
+		expected string
+	}{
+		{&compiler.Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpIterNext, 0))}, "not an iterator"},
+		{&compiler.Bytecode{
+			Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpClosure, 0, 1)),
+			Constants:    []object.Object{captures},
+		}, "not a variable to capture"},
+	}
+
+	for _, tt := range tests {
+		decoded := roundTrip(t, tt.bytecode)
+		err := vm.New(decoded).Run()
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func withFunction(bytecode *compiler.Bytecode, fn *object.CompiledFunction) *compiler.Bytecode {
+	bytecode.Constants = append(bytecode.Constants, fn)
+	return bytecode
+}
+
+func concat(ins ...[]byte) code.Instructions {
+	var out code.Instructions
+	for _, in := range ins {
+		out = append(out, in...)
+	}
+	return out
+}
+
+func compile(t testing.TB, filename, input string) *compiler.Bytecode {
+	t.Helper()
+
+	p := parser.New(lexer.NewFileReader(filename, strings.NewReader(input)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error for %q: %s", input, err)
+	}
+	return comp.Bytecode()
+}
+
+func roundTrip(t *testing.T, bytecode *compiler.Bytecode) *compiler.Bytecode {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, bytecode); err != nil {
+		t.Fatalf("encode failed: %s", err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode failed: %s", err)
+	}
+	return decoded
+}
+
+func withVersion(data []byte, version uint16) []byte {
+	out := append([]byte{}, data...)
+	binary.BigEndian.PutUint16(out[len(Magic):], version)
+	return out
+}
+
+func flip(data []byte, i int) []byte {
+	out := append([]byte{}, data...)
+	out[i] ^= 1
+	return out
+}
+
+func withoutChecksum(data []byte) []byte {
+	return append([]byte{}, data[:len(data)-checksumSize]...)
+}
+
+// replace sets the first instruction of the top level, which comes right
+// after its name, parameters, locals, local names, free names and the
+// length of its instructions, all of them a single byte here
+func replace(data []byte, i int, b byte) []byte {
+	out := append([]byte{}, data...)
+	out[headerSize+6+i] = b
+	return out
+}
+
+// reseal gives data the right checksum, so a test reaches the decoder
+// proper instead of stopping at the checksum
+func reseal(data []byte) []byte {
+	if len(data) < checksumSize {
+		return data
+	}
+	return seal(withoutChecksum(data))
+}
+
+func seal(body []byte) []byte {
+	sum := make([]byte, checksumSize)
+	binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(body))
+	return append(body, sum...)
+}
@@ -0,0 +1,162 @@
+package object
+
+import "unicode/utf8"
+
+// Builtins is shared by the evaluator and the compiler. the compiler refers
+// to a builtin by its index, so new builtins go at the end.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	// len counts the elements of an array, the pairs of a hash, or the
+	// characters (not bytes) of a string
+	{"len", &Builtin{Fn: func(args ...Object) Object {
+		if len(args) != 1 {
+			return NewError("wrong number of arguments: want=1, got=%d", len(args))
+		}
+		switch arg := args[0].(type) {
+		case *String:
+			return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+		case *Array:
+			return &Integer{Value: int64(len(arg.Elements))}
+		case *Hash:
+			return &Integer{Value: int64(arg.Len())}
+		default:
+			return NewError("argument to `len` not supported, got %s", args[0].Type())
+		}
+	}}},
+	// first and last return null for an empty array
+	{"first", &Builtin{Fn: func(args ...Object) Object {
+		arr, err := arrayArgument("first", 1, args)
+		if err != nil {
+			return err
+		}
+		if len(arr.Elements) == 0 {
+			return NULL
+		}
+		return arr.Elements[0]
+	}}},
+	{"last", &Builtin{Fn: func(args ...Object) Object {
+		arr, err := arrayArgument("last", 1, args)
+		if err != nil {
+			return err
+		}
+		if len(arr.Elements) == 0 {
+			return NULL
+		}
+		return arr.Elements[len(arr.Elements)-1]
+	}}},
+	// rest returns a new array without the first element, or null for an empty array
+	{"rest", &Builtin{Fn: func(args ...Object) Object {
+		arr, err := arrayArgument("rest", 1, args)
+		if err != nil {
+			return err
+		}
+		if len(arr.Elements) == 0 {
+			return NULL
+		}
+		elements := make([]Object, len(arr.Elements)-1)
+		copy(elements, arr.Elements[1:])
+		return &Array{Elements: elements}
+	}}},
+	// push returns a new array, the one passed in is left as it is
+	{"push", &Builtin{Fn: func(args ...Object) Object {
+		arr, err := arrayArgument("push", 2, args)
+		if err != nil {
+			return err
+		}
+		elements := make([]Object, len(arr.Elements)+1)
+		copy(elements, arr.Elements)
+		elements[len(arr.Elements)] = args[1]
+		return &Array{Elements: elements}
+	}}},
+	// keys and values return arrays in the order the keys were added
+	{"keys", &Builtin{Fn: func(args ...Object) Object {
+		hash, err := hashArgument("keys", 1, args)
+		if err != nil {
+			return err
+		}
+		keys := []Object{}
+		for _, pair := range hash.Pairs() {
+			keys = append(keys, pair.Key)
+		}
+		return &Array{Elements: keys}
+	}}},
+	{"values", &Builtin{Fn: func(args ...Object) Object {
+		hash, err := hashArgument("values", 1, args)
+		if err != nil {
+			return err
+		}
+		values := []Object{}
+		for _, pair := range hash.Pairs() {
+			values = append(values, pair.Value)
+		}
+		return &Array{Elements: values}
+	}}},
+	{"has", &Builtin{Fn: func(args ...Object) Object {
+		hash, err := hashArgument("has", 2, args)
+		if err != nil {
+			return err
+		}
+		key, ok := args[1].(Hashable)
+		if !ok {
+			return NewError("unusable as hash key: %s", args[1].Type())
+		}
+		_, found := hash.Get(key)
+		return NativeBoolToBooleanObject(found)
+	}}},
+	// delete returns a new hash without the key, the one passed in is left as it is
+	{"delete", &Builtin{Fn: func(args ...Object) Object {
+		hash, err := hashArgument("delete", 2, args)
+		if err != nil {
+			return err
+		}
+		key, ok := args[1].(Hashable)
+		if !ok {
+			return NewError("unusable as hash key: %s", args[1].Type())
+		}
+		deleted := key.HashKey()
+		result := NewHash()
+		for _, pair := range hash.Pairs() {
+			pairKey := pair.Key.(Hashable)
+			if pairKey.HashKey() != deleted {
+				result.Set(pairKey, pair.Value)
+			}
+		}
+		return result
+	}}},
+}
+
+// GetBuiltinByName returns nil when there is no builtin called name
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+// hashArgument checks the argument count of a builtin whose first argument is a hash
+func hashArgument(name string, want int, args []Object) (*Hash, *Error) {
+	if len(args) != want {
+		return nil, NewError("wrong number of arguments: want=%d, got=%d", want, len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return nil, NewError("argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+	return hash, nil
+}
+
+// arrayArgument checks the argument count of a builtin whose first argument is an array
+func arrayArgument(name string, want int, args []Object) (*Array, *Error) {
+	if len(args) != want {
+		return nil, NewError("wrong number of arguments: want=%d, got=%d", want, len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return nil, NewError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	return arr, nil
+}
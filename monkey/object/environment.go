@@ -0,0 +1,72 @@
+package object
+
+type Environment struct {
+	store  map[string]Object
+	consts map[string]bool // names in store bound with const
+	outer  *Environment
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object), consts: make(map[string]bool)}
+}
+
+// the enclosed environment is used for function calls: lookups fall back to
+// the environment the function was defined in
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// Set binds name in this environment. a const binding cannot be replaced,
+// see HasConst.
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
+
+// SetConst is like Set, but the binding cannot be assigned to afterwards
+func (e *Environment) SetConst(name string, val Object) Object {
+	e.store[name] = val
+	e.consts[name] = true
+	return val
+}
+
+// HasConst tells whether name is bound with const in this environment
+// itself, so a let or const of the same name here would redeclare it
+func (e *Environment) HasConst(name string) bool {
+	return e.consts[name]
+}
+
+// IsConst tells whether the binding that Get would find for name is a const
+func (e *Environment) IsConst(name string) bool {
+	if _, ok := e.store[name]; ok {
+		return e.consts[name]
+	}
+	if e.outer != nil {
+		return e.outer.IsConst(name)
+	}
+	return false
+}
+
+// Assign changes an existing binding in the innermost environment that has
+// it, unlike Set which always binds in this environment. ok is false when
+// the name is not bound anywhere. it does not check for consts, see IsConst.
+func (e *Environment) Assign(name string, val Object) (Object, bool) {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return val, true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return nil, false
+}
@@ -0,0 +1,76 @@
+package object
+
+import "testing"
+
+func TestEnclosedEnvironment(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	outer.Set("b", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("b", &Integer{Value: 3})
+
+	tests := []struct {
+		env      *Environment
+		name     string
+		expected int64
+	}{
+		{inner, "a", 1},
+		{inner, "b", 3},
+		{outer, "b", 2},
+	}
+	for _, tt := range tests {
+		obj, ok := tt.env.Get(tt.name)
+		if !ok {
+			t.Fatalf("%s should be found", tt.name)
+		}
+		if obj.(*Integer).Value != tt.expected {
+			t.Errorf("%s should be %d, got %s", tt.name, tt.expected, obj.Inspect())
+		}
+	}
+
+	if _, ok := outer.Get("c"); ok {
+		t.Errorf("c should not be found")
+	}
+}
+
+func TestAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+
+	if _, ok := inner.Assign("a", &Integer{Value: 2}); !ok {
+		t.Fatalf("a should be assignable from the inner environment")
+	}
+	if obj, _ := outer.Get("a"); obj.(*Integer).Value != 2 {
+		t.Errorf("assign should change the outer binding, got %s", obj.Inspect())
+	}
+	if _, ok := inner.store["a"]; ok {
+		t.Errorf("assign should not create a binding in the inner environment")
+	}
+	if _, ok := inner.Assign("b", &Integer{Value: 3}); ok {
+		t.Errorf("b is not bound, assign should fail")
+	}
+}
+
+func TestConst(t *testing.T) {
+	outer := NewEnvironment()
+	outer.SetConst("a", &Integer{Value: 1})
+	outer.Set("b", &Integer{Value: 2})
+	inner := NewEnclosedEnvironment(outer)
+
+	if !inner.IsConst("a") {
+		t.Errorf("a should be const through the inner environment")
+	}
+	if inner.IsConst("b") || inner.IsConst("c") {
+		t.Errorf("only a should be const")
+	}
+
+	inner.Set("a", &Integer{Value: 3})
+	if inner.IsConst("a") {
+		t.Errorf("a let in the inner environment shadows the const")
+	}
+	if !outer.HasConst("a") || inner.HasConst("a") || outer.HasConst("b") {
+		t.Errorf("only the outer environment itself has the const a")
+	}
+}
@@ -0,0 +1,92 @@
+package object
+
+import (
+	"bytes"
+	"hash/fnv"
+	"strings"
+)
+
+// HashKey is what a hash is indexed by. two objects with equal values have
+// equal hash keys, even when they are different objects.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable objects can be used as hash keys
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+// the original key is kept next to the value, so keys() and Inspect can show it
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash remembers the order keys were first added in, so iterating and
+// printing a hash always gives the same result
+type Hash struct {
+	pairs map[HashKey]HashPair
+	keys  []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+	pairs := []string{}
+	for _, pair := range h.Pairs() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+// Set adds or replaces the value for key. replacing keeps the key where it was.
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.pairs[hashKey]; !ok {
+		h.keys = append(h.keys, hashKey)
+	}
+	h.pairs[hashKey] = HashPair{Key: key.(Object), Value: value}
+}
+
+func (h *Hash) Len() int { return len(h.keys) }
+
+// Pairs returns the pairs in insertion order
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.keys))
+	for _, key := range h.keys {
+		pairs = append(pairs, h.pairs[key])
+	}
+	return pairs
+}
@@ -0,0 +1,43 @@
+package object
+
+import "testing"
+
+func TestHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+	if hello1.HashKey() == diff.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+	if (&Integer{Value: 1}).HashKey() != (&Integer{Value: 1}).HashKey() {
+		t.Errorf("integers with same value have different hash keys")
+	}
+	if (&Integer{Value: 1}).HashKey() == (&Boolean{Value: true}).HashKey() {
+		t.Errorf("1 and true should have different hash keys")
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "b"}, &Integer{Value: 1})
+	hash.Set(&Integer{Value: 2}, &Integer{Value: 2})
+	hash.Set(&String{Value: "a"}, &Integer{Value: 3})
+	hash.Set(&String{Value: "b"}, &Integer{Value: 4})
+
+	if hash.Len() != 3 {
+		t.Fatalf("expected 3 pairs, got %d", hash.Len())
+	}
+	if actual := hash.Inspect(); actual != "{b: 4, 2: 2, a: 3}" {
+		t.Errorf("pairs should be in insertion order, got %s", actual)
+	}
+	if value, ok := hash.Get(&Integer{Value: 2}); !ok || value.Inspect() != "2" {
+		t.Errorf("wrong value for key 2, got %v", value)
+	}
+	if _, ok := hash.Get(&Boolean{Value: true}); ok {
+		t.Errorf("true should not be in the hash")
+	}
+}
@@ -0,0 +1,281 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/ast"
+	"github.com/fandan-nyc/all-interpretors/monkey/code"
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ      = "INTEGER"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	NULL_OBJ         = "NULL"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	STRING_OBJ       = "STRING"
+	FLOAT_OBJ        = "FLOAT"
+	ARRAY_OBJ        = "ARRAY"
+	BUILTIN_OBJ      = "BUILTIN"
+	HASH_OBJ         = "HASH"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	EXCEPTION_OBJ    = "EXCEPTION"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CELL_OBJ              = "CELL"
+)
+
+// every value produced by the evaluator is an Object
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// a float always prints with a dot or an exponent, so 2.0 does not look like the integer 2
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+// there is only ever one true, one false and one null, so they can be
+// compared by pointer
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// return value wraps the value of a return statement, so the evaluator
+// knows to stop evaluating the rest of the enclosing block
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+// break and continue unwind the blocks of a loop body like a return value
+// does, until the loop catches them
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// Error is a runtime error, or a value thrown with throw. Pos is where it
+// happened, Stack the function calls it unwound through, innermost first.
+type Error struct {
+	Message string
+	Value   Object // the thrown value, nil for a runtime error
+	Pos     token.Position
+	Stack   []Frame
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+// Error makes an error that nothing caught usable as a Go error, which is
+// how the vm reports it
+func (e *Error) Error() string { return e.Message }
+
+// Frame is a call of Function at CallSite. Function is empty for a
+// function literal that was never bound with let.
+type Frame struct {
+	Function string
+	CallSite token.Position
+}
+
+// the trace only shows this many frames, the rest is elided like in Go
+const maxTraceFrames = 100
+
+// Trace renders the error like a Go panic, with the innermost function first:
+//
+//	ERROR: type mismatch: INTEGER + BOOLEAN
+//
+//	add()
+//		script.monkey:1:22
+//	<main>
+//		script.monkey:2:1
+func (e *Error) Trace() string {
+	var out bytes.Buffer
+	out.WriteString(e.Inspect())
+	out.WriteString("\n\n")
+
+	// every frame is at the call site of the frame inside it
+	pos := e.Pos
+	for i, frame := range e.Stack {
+		if i == maxTraceFrames {
+			out.WriteString("...additional frames elided...\n")
+			break
+		}
+		name := frame.Function
+		if name == "" {
+			name = "<anonymous>"
+		}
+		fmt.Fprintf(&out, "%s()\n\t%s\n", name, pos)
+		pos = frame.CallSite
+	}
+	fmt.Fprintf(&out, "<main>\n\t%s", pos)
+	return out.String()
+}
+
+// Exception is an error caught by try/catch. it is an ordinary value, while
+// an Error keeps unwinding until something catches it.
+type Exception struct {
+	Error *Error
+}
+
+func (e *Exception) Type() ObjectType { return EXCEPTION_OBJ }
+func (e *Exception) Inspect() string  { return e.Error.Inspect() }
+
+// function keeps the environment it was defined in, which is what makes closures work
+type Function struct {
+	Name       string // for stack traces, empty for an anonymous function
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	return FunctionSource(f.Parameters, f.Body)
+}
+
+// FunctionSource is how a function value prints, the same in both backends
+func FunctionSource(parameters []*ast.Identifier, body *ast.BlockStatement) string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(body.String())
+	out.WriteString("\n}")
+	return out.String()
+}
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+type BuiltinFunction func(args ...Object) Object
+
+// builtin is a function implemented in Go, like len
+type Builtin struct {
+	Fn BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
+
+// CompiledFunction is a function literal turned into bytecode. the names
+// are only kept for error messages.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	Lines         code.LineTable
+	NumLocals     int
+	NumParameters int
+	Name          string
+	LocalNames    []string // by slot, empty for the compiler's hidden locals
+	FreeNames     []string
+	Source        string // what a closure of it prints, see FunctionSource
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	name := cf.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	return fmt.Sprintf("CompiledFunction[%s]", name)
+}
+
+// Closure is a function value in the vm. it has the type of a Function, so
+// both backends report the same types in errors.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Cell
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	if c.Fn.Source != "" {
+		return c.Fn.Source
+	}
+	name := c.Fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	return fmt.Sprintf("Closure[%s]", name)
+}
+
+// Cell holds a variable that a function shares with the closures it
+// creates. it only lives in the vm, a program never sees one as a value.
+type Cell struct {
+	Value Object // nil until the variable is set
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string  { return "Cell" }
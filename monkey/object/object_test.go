@@ -0,0 +1,52 @@
+package object
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{2, "2.0"},
+		{3.25, "3.25"},
+		{1e21, "1e+21"},
+	}
+
+	for _, tt := range tests {
+		if actual := (&Float{Value: tt.value}).Inspect(); actual != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, actual)
+		}
+	}
+}
+
+func TestErrorTrace(t *testing.T) {
+	err := &Error{
+		Message: "division by zero",
+		Pos:     token.Position{Filename: "a.monkey", Line: 1, Column: 9},
+		Stack: []Frame{
+			{Function: "", CallSite: token.Position{Filename: "a.monkey", Line: 2, Column: 3}},
+			{Function: "div", CallSite: token.Position{Filename: "a.monkey", Line: 4, Column: 1}},
+		},
+	}
+	expected := "ERROR: division by zero\n\n" +
+		"<anonymous>()\n\ta.monkey:1:9\n" +
+		"div()\n\ta.monkey:2:3\n" +
+		"<main>\n\ta.monkey:4:1"
+	if actual := err.Trace(); actual != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, actual)
+	}
+
+	deep := &Error{Message: "deep"}
+	for i := 0; i < maxTraceFrames+5; i++ {
+		deep.Stack = append(deep.Stack, Frame{Function: "f"})
+	}
+	trace := deep.Trace()
+	if strings.Count(trace, "f()") != maxTraceFrames || !strings.Contains(trace, "...additional frames elided...") {
+		t.Errorf("a deep stack should be cut at %d frames, got\n%s", maxTraceFrames, trace)
+	}
+}
@@ -0,0 +1,364 @@
+package object
+
+import (
+	"fmt"
+	"math"
+)
+
+// the operators, indexing, truthiness and throw are shared by the evaluator
+// and the vm, like the builtins, so both backends give the same results and
+// the same errors
+
+func NewError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func NativeBoolToBooleanObject(input bool) *Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+// IsTruthy is false for false and null only
+func IsTruthy(obj Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+// PrefixOperation applies ! or - to right
+func PrefixOperation(operator string, right Object) Object {
+	switch operator {
+	case "!":
+		return NativeBoolToBooleanObject(!IsTruthy(right))
+	case "-":
+		switch right := right.(type) {
+		case *Integer:
+			return &Integer{Value: -right.Value}
+		case *Float:
+			return &Float{Value: -right.Value}
+		}
+	}
+	return NewError("unknown operator: %s%s", operator, right.Type())
+}
+
+// InfixOperation applies an arithmetic or comparison operator. && and || are
+// not here, they decide themselves whether to look at the right side.
+func InfixOperation(operator string, left, right Object) Object {
+	switch {
+	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
+		return integerOperation(operator, left, right)
+	// an integer mixed with a float is promoted to float
+	case isNumeric(left) && isNumeric(right):
+		return floatOperation(operator, left, right)
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return stringOperation(operator, left, right)
+	case left.Type() != right.Type():
+		return NewError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	// booleans and null are singletons, so pointer comparison is enough
+	case operator == "==":
+		return NativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return NativeBoolToBooleanObject(left != right)
+	default:
+		return NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func integerOperation(operator string, left, right Object) Object {
+	leftVal := left.(*Integer).Value
+	rightVal := right.(*Integer).Value
+
+	switch operator {
+	case "+":
+		return &Integer{Value: leftVal + rightVal}
+	case "-":
+		return &Integer{Value: leftVal - rightVal}
+	case "*":
+		return &Integer{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return NewError("division by zero")
+		}
+		return &Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return NewError("division by zero")
+		}
+		return &Integer{Value: leftVal % rightVal}
+	case "**":
+		// a negative exponent has no integer result
+		if rightVal < 0 {
+			return &Float{Value: math.Pow(float64(leftVal), float64(rightVal))}
+		}
+		return &Integer{Value: integerPower(leftVal, rightVal)}
+	case "<":
+		return NativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return NativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return NativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return NativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return NativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return NativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func floatOperation(operator string, left, right Object) Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &Float{Value: leftVal + rightVal}
+	case "-":
+		return &Float{Value: leftVal - rightVal}
+	case "*":
+		return &Float{Value: leftVal * rightVal}
+	case "/":
+		return &Float{Value: leftVal / rightVal}
+	case "%":
+		return &Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &Float{Value: math.Pow(leftVal, rightVal)}
+	case "<":
+		return NativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return NativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return NativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return NativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return NativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return NativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func stringOperation(operator string, left, right Object) Object {
+	leftVal := left.(*String).Value
+	rightVal := right.(*String).Value
+
+	switch operator {
+	case "+":
+		return &String{Value: leftVal + rightVal}
+	case "<":
+		return NativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return NativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return NativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return NativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return NativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return NativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// integerPower computes base ** exp for exp >= 0 by squaring. like the other
+// integer operators it wraps around on overflow.
+func integerPower(base, exp int64) int64 {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exp >>= 1
+	}
+	return result
+}
+
+func isNumeric(obj Object) bool {
+	return obj.Type() == INTEGER_OBJ || obj.Type() == FLOAT_OBJ
+}
+
+func toFloat(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value)
+	case *Float:
+		return obj.Value
+	}
+	return 0
+}
+
+// Index is left[index]
+func Index(left, index Object) Object {
+	switch {
+	case left.Type() == ARRAY_OBJ && index.Type() == INTEGER_OBJ:
+		return arrayIndex(left, index)
+	case left.Type() == ARRAY_OBJ:
+		return NewError("array index must be INTEGER, got %s", index.Type())
+	case left.Type() == HASH_OBJ:
+		return hashIndex(left, index)
+	case left.Type() == EXCEPTION_OBJ:
+		return exceptionIndex(left, index)
+	default:
+		return NewError("index operator not supported: %s", left.Type())
+	}
+}
+
+// a negative index counts from the end, so arr[-1] is the last element.
+// an index out of range gives null rather than an error.
+func arrayIndex(array, index Object) Object {
+	elements := array.(*Array).Elements
+	idx := index.(*Integer).Value
+	if idx < 0 {
+		idx += int64(len(elements))
+	}
+	if idx < 0 || idx >= int64(len(elements)) {
+		return NULL
+	}
+	return elements[idx]
+}
+
+// a missing key gives null, like an array index out of range
+func hashIndex(hash, index Object) Object {
+	key, ok := index.(Hashable)
+	if !ok {
+		return NewError("unusable as hash key: %s", index.Type())
+	}
+	value, ok := hash.(*Hash).Get(key)
+	if !ok {
+		return NULL
+	}
+	return value
+}
+
+// a caught error can be looked into with e["message"], e["value"],
+// e["file"], e["line"] and e["column"]
+func exceptionIndex(exception, index Object) Object {
+	err := exception.(*Exception).Error
+	key, ok := index.(*String)
+	if !ok {
+		return NewError("error field must be STRING, got %s", index.Type())
+	}
+	switch key.Value {
+	case "message":
+		return &String{Value: err.Message}
+	case "value":
+		if err.Value == nil {
+			return &String{Value: err.Message}
+		}
+		return err.Value
+	case "file":
+		return &String{Value: err.Pos.Filename}
+	case "line":
+		return &Integer{Value: int64(err.Pos.Line)}
+	case "column":
+		return &Integer{Value: int64(err.Pos.Column)}
+	}
+	return NULL
+}
+
+// SetIndex is left[index] = value, which changes the array or hash in place
+// so every binding that refers to it sees the change. operator is the
+// operator of a compound assignment, + for +=, or empty for a plain one.
+func SetIndex(left, index, value Object, operator string) Object {
+	apply := func(current Object) Object {
+		if operator == "" {
+			return value
+		}
+		return InfixOperation(operator, current, value)
+	}
+
+	switch left := left.(type) {
+	case *Array:
+		idx, ok := index.(*Integer)
+		if !ok {
+			return NewError("array index must be INTEGER, got %s", index.Type())
+		}
+		// unlike reading, writing out of range is an error
+		i := idx.Value
+		if i < 0 {
+			i += int64(len(left.Elements))
+		}
+		if i < 0 || i >= int64(len(left.Elements)) {
+			return NewError("index out of range: %d with length %d", idx.Value, len(left.Elements))
+		}
+		result := apply(left.Elements[i])
+		if _, isErr := result.(*Error); isErr {
+			return result
+		}
+		left.Elements[i] = result
+		return result
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return NewError("unusable as hash key: %s", index.Type())
+		}
+		if operator != "" {
+			current, ok := left.Get(key)
+			if !ok {
+				return NewError("key not found: %s", index.Inspect())
+			}
+			value = apply(current)
+			if _, isErr := value.(*Error); isErr {
+				return value
+			}
+		}
+		left.Set(key, value)
+		return value
+	default:
+		return NewError("index assignment not supported: %s", left.Type())
+	}
+}
+
+// IterationItems is what for (x in iterable) goes over: the elements of an
+// array, the keys of a hash or the characters of a string. an array is
+// copied, so assigning to it inside the loop does not change what we iterate.
+func IterationItems(iterable Object) ([]Object, *Error) {
+	var items []Object
+	switch iterable := iterable.(type) {
+	case *Array:
+		items = append(items, iterable.Elements...)
+	case *Hash:
+		for _, pair := range iterable.Pairs() {
+			items = append(items, pair.Key)
+		}
+	case *String:
+		for _, ch := range iterable.Value {
+			items = append(items, &String{Value: string(ch)})
+		}
+	default:
+		return nil, NewError("cannot iterate over %s", iterable.Type())
+	}
+	return items, nil
+}
+
+// ThrownError turns the value of a throw into an error. throwing a caught
+// error again keeps where it first happened and the calls it already
+// unwound through.
+func ThrownError(val Object) *Error {
+	if exception, ok := val.(*Exception); ok {
+		rethrown := *exception.Error
+		rethrown.Stack = append([]Frame(nil), exception.Error.Stack...)
+		return &rethrown
+	}
+	message := val.Inspect()
+	if str, ok := val.(*String); ok {
+		message = str.Value
+	}
+	return &Error{Message: message, Value: val}
+}
@@ -0,0 +1,54 @@
+package object
+
+import "testing"
+
+func TestOperations(t *testing.T) {
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+	half := &Float{Value: 0.5}
+	tests := []struct {
+		result   Object
+		expected string
+	}{
+		{InfixOperation("+", one, two), "3"},
+		{InfixOperation("+", one, half), "1.5"},
+		{InfixOperation("**", two, &Integer{Value: -1}), "0.5"},
+		{InfixOperation("/", one, &Integer{Value: 0}), "ERROR: division by zero"},
+		{InfixOperation("+", &String{Value: "a"}, &String{Value: "b"}), "ab"},
+		{InfixOperation("==", TRUE, TRUE), "true"},
+		{InfixOperation("+", one, TRUE), "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{InfixOperation("+", TRUE, FALSE), "ERROR: unknown operator: BOOLEAN + BOOLEAN"},
+		{PrefixOperation("-", half), "-0.5"},
+		{PrefixOperation("!", NULL), "true"},
+		{PrefixOperation("-", TRUE), "ERROR: unknown operator: -BOOLEAN"},
+		{Index(&Array{Elements: []Object{one, two}}, &Integer{Value: -1}), "2"},
+		{Index(&Array{Elements: []Object{one}}, &Integer{Value: 5}), "null"},
+		{Index(one, one), "ERROR: index operator not supported: INTEGER"},
+		{SetIndex(&Array{Elements: []Object{one}}, &Integer{Value: 0}, two, "+"), "3"},
+		{SetIndex(&Array{Elements: []Object{one}}, &Integer{Value: 1}, two, ""), "ERROR: index out of range: 1 with length 1"},
+		{SetIndex(NewHash(), &String{Value: "k"}, two, "-"), "ERROR: key not found: k"},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.result.Inspect(); actual != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, actual)
+		}
+	}
+}
+
+func TestThrownError(t *testing.T) {
+	err := ThrownError(&String{Value: "boom"})
+	if err.Message != "boom" || err.Value.Inspect() != "boom" {
+		t.Errorf("wrong error for a thrown string: %+v", err)
+	}
+
+	caught := &Error{Message: "caught", Stack: []Frame{{Function: "f"}}}
+	rethrown := ThrownError(&Exception{Error: caught})
+	if rethrown == caught || rethrown.Message != "caught" || len(rethrown.Stack) != 1 {
+		t.Fatalf("a rethrown error should be a copy of the caught one, got %+v", rethrown)
+	}
+	rethrown.Stack[0].Function = "g"
+	if caught.Stack[0].Function != "f" {
+		t.Errorf("the rethrown error shares its stack with the caught one")
+	}
+}
@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+type ErrorKind int
+
+const (
+	UnexpectedToken   ErrorKind = iota // we expected one token type and got another
+	NoPrefixParseFn                    // the token cannot start an expression
+	InvalidLiteral                     // the literal is malformed, e.g. an integer that does not fit
+	LexicalError                       // the lexer gave us an ILLEGAL token
+	InvalidAssignment                  // the left side of an assignment cannot be assigned to
+	OutsideLoop                        // break or continue that is not inside a loop
+	TooManyErrors                      // the parser gave up, see maxErrors
+)
+
+var errorKindNames = map[ErrorKind]string{
+	UnexpectedToken:   "unexpected token",
+	NoPrefixParseFn:   "no prefix parse function",
+	InvalidLiteral:    "invalid literal",
+	LexicalError:      "lexical error",
+	InvalidAssignment: "invalid assignment",
+	OutsideLoop:       "outside loop",
+	TooManyErrors:     "too many errors",
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// ParseError is a single parser error. Msg is the human readable message,
+// the other fields let tooling inspect the error without parsing Msg.
+type ParseError struct {
+	Kind     ErrorKind
+	Expected []token.TokenType // only set for UnexpectedToken
+	Got      token.Token       // the offending token
+	Pos      token.Position
+	Msg      string
+}
+
+func (e *ParseError) Error() string {
+	if e.Pos.IsValid() || e.Pos.Filename != "" {
+		return e.Pos.String() + ": " + e.Msg
+	}
+	return e.Msg
+}
+
+// Render prints the error followed by the offending line of src and a caret
+// underline below the offending token:
+//
+//	test.monkey:1:5: expected next token to be IDENT, got = instead
+//	let = 5;
+//	    ^
+func (e *ParseError) Render(src string) string {
+	var out bytes.Buffer
+	out.WriteString(e.Error())
+	if !e.Pos.IsValid() {
+		return out.String()
+	}
+	line, ok := sourceLine(src, e.Pos.Line)
+	if !ok {
+		return out.String()
+	}
+	out.WriteString("\n")
+	out.WriteString(line)
+	out.WriteString("\n")
+
+	// columns count runes. copy tabs from the source line, so the caret
+	// lines up however wide the terminal renders them
+	column := 1
+	for _, ch := range line {
+		if column >= e.Pos.Column {
+			break
+		}
+		if ch == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+		column++
+	}
+	width := 1
+	if e.Got.End.Line == e.Pos.Line && e.Got.End.Column-e.Pos.Column > 1 {
+		width = e.Got.End.Column - e.Pos.Column
+	}
+	out.WriteString(strings.Repeat("^", width))
+	return out.String()
+}
+
+func sourceLine(src string, n int) (string, bool) {
+	lines := strings.Split(src, "\n")
+	if n < 1 || n > len(lines) {
+		return "", false
+	}
+	return strings.TrimSuffix(lines[n-1], "\r"), true
+}
+
+// ErrorList is the list of errors of a parse, in the order they were found
+type ErrorList []*ParseError
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns nil for an empty list, so callers can write `if err := list.Err(); err != nil`
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// Render renders every error in the list, separated by blank lines
+func (l ErrorList) Render(src string) string {
+	rendered := make([]string, 0, len(l))
+	for _, e := range l {
+		rendered = append(rendered, e.Render(src))
+	}
+	return strings.Join(rendered, "\n\n")
+}
@@ -0,0 +1,312 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/lexer"
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+func TestParseErrorFields(t *testing.T) {
+	input := "let x = 5;\nlet = 10;"
+	p := New(lexer.NewFile("test.monkey", input))
+	p.ParseProgram()
+
+	errs := p.ParseErrors()
+	if len(errs) == 0 {
+		t.Fatalf("expected parse errors")
+	}
+	e := errs[0]
+	if e.Kind != UnexpectedToken {
+		t.Errorf("expected kind %s, got %s", UnexpectedToken, e.Kind)
+	}
+	if len(e.Expected) != 1 || e.Expected[0] != token.IDENT {
+		t.Errorf("expected [IDENT], got %v", e.Expected)
+	}
+	if e.Got.Type != token.ASSIGN {
+		t.Errorf("expected got token =, got %s", e.Got.Type)
+	}
+	if e.Pos.String() != "test.monkey:2:5" {
+		t.Errorf("expected position test.monkey:2:5, got %s", e.Pos)
+	}
+	if e.Error() != "test.monkey:2:5: expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong error string, got %q", e.Error())
+	}
+	if p.Errors()[0] != "expected next token to be IDENT, got = instead" {
+		t.Errorf("Errors should keep the plain message, got %q", p.Errors()[0])
+	}
+}
+
+func TestParseErrorRender(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = 5;\nlet = 10;",
+			"2:5: expected next token to be IDENT, got = instead\nlet = 10;\n    ^",
+		},
+		{
+			"\tlet x 99;",
+			"1:8: expected next token to be =, got INT instead\n\tlet x 99;\n\t      ^^",
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.ParseErrors()
+		if len(errs) == 0 {
+			t.Fatalf("expected parse errors for %q", tt.input)
+		}
+		if actual := errs[0].Render(tt.input); actual != tt.expected {
+			t.Errorf("expected\n%s\ngot\n%s", tt.expected, actual)
+		}
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	var empty ErrorList
+	if empty.Err() != nil {
+		t.Errorf("empty list should have a nil Err")
+	}
+
+	list := ErrorList{
+		{Msg: "first", Pos: token.Position{Line: 1, Column: 2}},
+		{Msg: "second", Pos: token.Position{Line: 3, Column: 4}},
+	}
+	if list.Err() == nil {
+		t.Fatalf("non empty list should have an Err")
+	}
+	if list.Error() != "1:2: first (and 1 more errors)" {
+		t.Errorf("wrong error string, got %q", list.Error())
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+		expectedAST    string
+	}{
+		{
+			"let = 5; let x = 1;",
+			[]string{"expected next token to be IDENT, got = instead"},
+			"let x = 1;",
+		},
+		{
+			"let x 5\nlet y = 2\ny",
+			[]string{"expected next token to be =, got INT instead"},
+			"let y = 2;y",
+		},
+		{
+			"let f = fn(x) { let = 1; x + }; let g = 2;",
+			[]string{
+				"expected next token to be IDENT, got = instead",
+				"no prefix parser func for }",
+			},
+			"let f = fn(x) ;let g = 2;",
+		},
+		{
+			"if (x { a; b } let y = 3;",
+			[]string{"expected next token to be ), got { instead"},
+			"let y = 3;",
+		},
+		{
+			"} 1 + 2",
+			[]string{"no prefix parser func for }"},
+			"(1 + 2)",
+		},
+		{
+			"let x = ",
+			[]string{"no prefix parser func for EOF"},
+			"",
+		},
+		{
+			`let h = {"a" 1, "b": {2: 3}}; let y = 2;`,
+			[]string{"expected next token to be :, got INT instead"},
+			"let y = 2;",
+		},
+		{
+			`let f = fn() { {"a": } }; f`,
+			[]string{"no prefix parser func for }"},
+			"let f = fn() ;f",
+		},
+		{
+			"f() = 1; const = 2; a[0] = 3",
+			[]string{
+				"cannot assign to f()",
+				"expected next token to be IDENT, got = instead",
+			},
+			"((a[0]) = 3)",
+		},
+		{
+			"break; while (x) { let f = fn() { continue; 1 }; break }",
+			[]string{"break outside loop", "continue outside loop"},
+			"while (x) {let f = fn() 1;break;}",
+		},
+		{
+			"for (x of xs) { x } let y = 1;",
+			[]string{"expected next token to be IN, got IDENT instead"},
+			"let y = 1;",
+		},
+		{
+			"let x = try { 1 }; throw x",
+			[]string{"expected next token to be CATCH or FINALLY, got ; instead"},
+			"throw x;",
+		},
+		{
+			"try { 1 } catch { 2 }; 3",
+			[]string{"expected next token to be (, got { instead"},
+			"3",
+		},
+		{
+			"1 += 2; x += 1",
+			[]string{"cannot assign to 1"},
+			"(x += 1)",
+		},
+		{
+			"let a = 1; fn() { if (x) { while (y) {",
+			[]string{"expected token to be }, got EOF instead"},
+			"let a = 1;",
+		},
+		{
+			"let f = fn() { let a = [1, ",
+			[]string{"no prefix parser func for EOF"},
+			"",
+		},
+		{
+			"let x = 1; // fine\nx /* never closed",
+			[]string{"unterminated block comment"},
+			"let x = 1;x",
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		errs := p.Errors()
+		if len(errs) != len(tt.expectedErrors) {
+			t.Errorf("input %q: expected errors %q, got %q", tt.input, tt.expectedErrors, errs)
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errs[i] != msg {
+				t.Errorf("input %q: expected error %q, got %q", tt.input, msg, errs[i])
+			}
+		}
+		if program.String() != tt.expectedAST {
+			t.Errorf("input %q: expected partial program %q, got %q", tt.input, tt.expectedAST, program.String())
+		}
+	}
+}
+
+func TestErrorLimit(t *testing.T) {
+	input := ""
+	for i := 0; i < 2*maxErrors; i++ {
+		input += "let = 1;\n"
+	}
+	input += "let x = 1;"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+
+	errs := p.ParseErrors()
+	if len(errs) != maxErrors+1 {
+		t.Fatalf("expected %d errors, got %d", maxErrors+1, len(errs))
+	}
+	if last := errs[len(errs)-1]; last.Kind != TooManyErrors {
+		t.Errorf("last error should be %s, got %s", TooManyErrors, last.Kind)
+	}
+	if program == nil || len(program.Statements) != 0 {
+		t.Errorf("expected an empty partial program, got %v", program)
+	}
+}
+
+func TestErrorLimitInParseStatement(t *testing.T) {
+	input := "if (x) {\n"
+	for i := 0; i < 2*maxErrors; i++ {
+		input += "let = 1;\n"
+	}
+	input += "}"
+
+	p := New(lexer.New(input))
+	stmt := p.ParseStatement()
+
+	if stmt != nil {
+		t.Errorf("expected no statement, got %v", stmt)
+	}
+	errs := p.ParseErrors()
+	if len(errs) != maxErrors+1 || errs[len(errs)-1].Kind != TooManyErrors {
+		t.Errorf("expected %d errors ending in %s, got %v", maxErrors+1, TooManyErrors, errs)
+	}
+}
+
+func TestLexicalErrors(t *testing.T) {
+	input := "let s = \"abc\\qdef\";\nlet t = \"open"
+	p := New(lexer.NewFile("test.monkey", input))
+	p.ParseProgram()
+
+	errs := p.ParseErrors()
+	expected := []string{
+		`test.monkey:1:13: unknown escape sequence \q`,
+		`test.monkey:2:9: unterminated string literal`,
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(errs), errs)
+	}
+	for i, e := range errs {
+		if e.Kind != LexicalError {
+			t.Errorf("errs[%d]: expected kind %s, got %s", i, LexicalError, e.Kind)
+		}
+		if e.Error() != expected[i] {
+			t.Errorf("errs[%d]: expected %q, got %q", i, expected[i], e.Error())
+		}
+	}
+}
+
+func TestParseErrorRenderUnicode(t *testing.T) {
+	input := `let café "naïve";`
+	p := New(lexer.New(input))
+	p.ParseProgram()
+
+	errs := p.ParseErrors()
+	if len(errs) == 0 {
+		t.Fatalf("expected parse errors")
+	}
+	expected := "1:10: expected next token to be =, got STRING instead\nlet café \"naïve\";\n         ^^^^^^^"
+	if actual := errs[0].Render(input); actual != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, actual)
+	}
+}
+
+func TestNumberLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedErr string
+	}{
+		{"let x = 9223372036854775808;", "1:9: integer literal 9223372036854775808 overflows int64"},
+		{"let x = 0x1_0000_0000_0000_0000;", "1:9: integer literal 0x1_0000_0000_0000_0000 overflows int64"},
+		{"let x = 1e400;", "1:9: float literal 1e400 overflows float64"},
+		{"let x = 0b12;", "1:9: invalid digit '2' in binary literal"},
+		{"let x = 0755;", "1:9: leading zero in 0755, write 0o755 for an octal or 755 for a decimal literal"},
+		{"let x = 089;", "1:9: leading zero in 089, write 89 for a decimal literal"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.ParseErrors()
+		if len(errs) != 1 {
+			t.Errorf("input %q: expected 1 error, got %v", tt.input, errs)
+			continue
+		}
+		if errs[0].Kind != InvalidLiteral && errs[0].Kind != LexicalError {
+			t.Errorf("input %q: unexpected error kind %s", tt.input, errs[0].Kind)
+		}
+		if errs[0].Error() != tt.expectedErr {
+			t.Errorf("input %q: expected %q, got %q", tt.input, tt.expectedErr, errs[0].Error())
+		}
+	}
+}
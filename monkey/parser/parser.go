@@ -6,44 +6,116 @@ import (
 	"github.com/fandan-nyc/all-interpretors/monkey/lexer"
 	"github.com/fandan-nyc/all-interpretors/monkey/token"
 	"strconv"
+	"strings"
 )
 
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // x = y or x += y
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
+	POWER       // x ** y, binds tighter than prefix so -2 ** 2 is -(2 ** 2)
 	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
+var precedences = map[token.TokenType]int{
+	token.ASSIGN:       ASSIGN,
+	token.PLUS_ASSIGN:  ASSIGN,
+	token.MINUS_ASSIGN: ASSIGN,
+	token.OR:           OR,
+	token.AND:          AND,
+	token.EQ:           EQUALS,
+	token.NOT_EQ:       EQUALS,
+	token.LT:           LESSGREATER,
+	token.GT:           LESSGREATER,
+	token.LT_EQ:        LESSGREATER,
+	token.GT_EQ:        LESSGREATER,
+	token.PLUS:         SUM,
+	token.MINUS:        SUM,
+	token.SLASH:        PRODUCT,
+	token.ASTERISK:     PRODUCT,
+	token.PERCENT:      PRODUCT,
+	token.POWER:        POWER,
+	token.LPAREN:       CALL,
+	token.LBRACKET:     INDEX,
+}
+
+// right associative operators group from the right: a ** b ** c is a ** (b ** c)
+var rightAssociative = map[token.TokenType]bool{
+	token.ASSIGN:       true,
+	token.PLUS_ASSIGN:  true,
+	token.MINUS_ASSIGN: true,
+	token.POWER:        true,
+}
+
 type (
 	prefixParserFn func() ast.Expression
 	infixParserFn  func(ast.Expression) ast.Expression
 )
 
 type Parser struct {
-	l *lexer.Lexer
+	l      *lexer.Lexer
+	tokens *lexer.Buffer // tokens after peekToken
 
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    ErrorList
+
+	openHashes int // hash literals being parsed, for error recovery
+	loopDepth  int // loops around the current statement, in the current function
+
+	// the outermost ( and ) around each grouped expression, which the
+	// expression built around it takes into its span
+	parens map[ast.Expression][2]token.Token
 
 	prefixParserFns map[token.TokenType]prefixParserFn
 	infixParserFns  map[token.TokenType]infixParserFn
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, tokens: lexer.NewBuffer(l), errors: ErrorList{}}
 	p.infixParserFns = make(map[token.TokenType]infixParserFn)
 	p.prefixParserFns = make(map[token.TokenType]prefixParserFn)
+	p.parens = make(map[ast.Expression][2]token.Token)
 
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TRUE, p.parseBoolean)
+	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	// blocks are only parsed right after if and fn, so a { anywhere an
+	// expression can start is a hash literal
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+
+	for _, t := range []token.TokenType{
+		token.PLUS, token.MINUS, token.ASTERISK, token.SLASH,
+		token.PERCENT, token.POWER,
+		token.EQ, token.NOT_EQ, token.LT, token.GT, token.LT_EQ, token.GT_EQ,
+		token.AND, token.OR,
+	} {
+		p.registerInfix(t, p.parseInfixExpression)
+	}
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	// read two tokens, so curToken and peekToken are both set
 	p.nextToken()
 	p.nextToken()
@@ -62,41 +134,104 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// Errors returns the error messages without positions. use ParseErrors for
+// the structured form.
 func (p *Parser) Errors() []string {
+	msgs := make([]string, 0, len(p.errors))
+	for _, e := range p.errors {
+		msgs = append(msgs, e.Msg)
+	}
+	return msgs
+}
+
+func (p *Parser) ParseErrors() ErrorList {
 	return p.errors
 }
 
+// addError records the error and abandons the statement being parsed, see recovery.go
+func (p *Parser) addError(kind ErrorKind, tok token.Token, expected []token.TokenType, format string, args ...interface{}) {
+	// once the input has run out, every construct still open would report
+	// that it is not closed. the first of them is enough.
+	if n := len(p.errors); tok.Type == token.EOF && n > 0 && p.errors[n-1].Got.Type == token.EOF {
+		panic(bailout{})
+	}
+	p.errors = append(p.errors, &ParseError{
+		Kind:     kind,
+		Expected: expected,
+		Got:      tok,
+		Pos:      tok.Pos,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+	if len(p.errors) >= maxErrors {
+		p.errors = append(p.errors, &ParseError{
+			Kind: TooManyErrors,
+			Got:  p.curToken,
+			Pos:  p.curToken.Pos,
+			Msg:  "too many errors",
+		})
+		panic(errorLimit{})
+	}
+	panic(bailout{})
+}
+
 func (p *Parser) peakErrors(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(UnexpectedToken, p.peekToken, []token.TokenType{t},
+		"expected next token to be %s, got %s instead", t, p.peekToken.Type)
+}
+
+func (p *Parser) curErrors(t token.TokenType) {
+	p.addError(UnexpectedToken, p.curToken, []token.TokenType{t},
+		"expected token to be %s, got %s instead", t, p.curToken.Type)
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.peekToken = p.tokens.Next()
 }
 
-func (p *Parser) ParseProgram() *ast.Program {
-	program := &ast.Program{}
+// ParseProgram always returns a program. when there are errors it holds the
+// statements that did parse, so editors can still work with half-written files.
+func (p *Parser) ParseProgram() (program *ast.Program) {
+	program = &ast.Program{}
 	program.Statements = []ast.Statement{}
+	defer p.recoverErrorLimit()
 
 	for p.curToken.Type != token.EOF {
-		stmt := p.ParseStatement()
+		stmt := p.parseStatement()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
+			p.nextToken()
 		}
-		p.nextToken()
 	}
 	return program
 }
 
-func (p *Parser) ParseStatement() ast.Statement {
+// ParseStatement parses a single statement, like parseStatement. it returns
+// nil when the error limit is reached, which ends the whole parse otherwise.
+func (p *Parser) ParseStatement() (stmt ast.Statement) {
+	defer p.recoverErrorLimit()
+	return p.parseStatement()
+}
+
+// parseStatement parses the statement starting at curToken and leaves curToken
+// on its last token. if the statement is broken it returns nil instead, with
+// curToken already on the first token after the broken part.
+func (p *Parser) parseStatement() (stmt ast.Statement) {
+	defer p.recoverStatement(p.curToken, p.openHashes, &stmt)
+
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -112,32 +247,62 @@ func (p *Parser) parseExpressionStatement() ast.Statement {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parser func for %s", t)
-	p.errors = append(p.errors, msg)
+	p.addError(NoPrefixParseFn, p.curToken, nil, "no prefix parser func for %s", t)
 }
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParserFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
 	}
 	leftExp := prefix()
+
+	// keep folding infix operators into leftExp as long as the next operator
+	// binds tighter than the one we were called with
+	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+		infix := p.infixParserFns[p.peekToken.Type]
+		if infix == nil {
+			return leftExp
+		}
+		p.nextToken()
+		leftExp = infix(leftExp)
+	}
 	return leftExp
 }
 
+func (p *Parser) peekPrecedence() int {
+	if p, ok := precedences[p.peekToken.Type]; ok {
+		return p
+	}
+	return LOWEST
+}
+
+func (p *Parser) curPrecedence() int {
+	if p, ok := precedences[p.curToken.Type]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	fmt.Printf("statement %s %s\n", p.curToken.Type, p.curToken.Literal)
 	stmt := &ast.ReturnStatement{Token: p.curToken}
+	// a bare return gives null
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	}
 	p.nextToken()
-	//// TODO: skipping the expression till we see a semicolon
-	for !p.curTokenIs(token.SEMICOLON) {
+
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+	// the semicolon is optional, so `return x` at the end of a REPL line works
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	fmt.Printf("statement %s %s\n", p.curToken.Type, p.curToken.Literal)
 	stmt := &ast.LetStatement{Token: p.curToken}
 
 	if !p.expectPeek(token.IDENT) {
@@ -147,7 +312,92 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
-	for !p.curTokenIs(token.SEMICOLON) {
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+	// let add = fn... gives the function a name to show in stack traces
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fn.Name = stmt.Name.Value
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseLoopBody parses a block in which break and continue are allowed
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+	if p.loopDepth == 0 {
+		p.addError(OutsideLoop, tok, nil, "%s outside loop", tok.Literal)
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
@@ -157,16 +407,65 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{
 		Token: p.curToken,
 	}
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
-	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+	// the lexer already checked the digits, so only the range can be wrong
+	digits, base := integerDigits(p.curToken.Literal)
+	value, err := strconv.ParseInt(digits, base, 64)
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		p.addError(InvalidLiteral, p.curToken, nil, "integer literal %s overflows int64", p.curToken.Literal)
+	} else if err != nil {
+		p.addError(InvalidLiteral, p.curToken, nil, "could not parse %q as integer", p.curToken.Literal)
+	}
+	lit.Value = value
+	return lit
+}
+
+// integerDigits strips the base prefix and the digit separators off an
+// integer literal. the lexer rejects a leading 0 without a letter.
+func integerDigits(literal string) (string, int) {
+	base := 10
+	if len(literal) > 2 && literal[0] == '0' {
+		switch literal[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			literal = literal[2:]
+		}
+	}
+	return strings.Replace(literal, "_", "", -1), base
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+	value, err := strconv.ParseFloat(strings.Replace(p.curToken.Literal, "_", "", -1), 64)
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		p.addError(InvalidLiteral, p.curToken, nil, "float literal %s overflows float64", p.curToken.Literal)
+	} else if err != nil {
+		p.addError(InvalidLiteral, p.curToken, nil, "could not parse %q as float", p.curToken.Literal)
 	}
 	lit.Value = value
 	return lit
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// the lexer already knows what is wrong with an illegal token, so report its message
+func (p *Parser) parseIllegal() ast.Expression {
+	tok := p.curToken
+	if lexErr, ok := p.l.ErrorAt(tok); ok {
+		tok.Pos = lexErr.Pos
+		p.addError(LexicalError, tok, nil, "%s", lexErr.Msg)
+	} else {
+		p.addError(LexicalError, tok, nil, "illegal token %q", tok.Literal)
+	}
+	return nil
+}
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
@@ -175,9 +474,289 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	}
 	p.nextToken()
 	expression.Right = p.parseExpression(PREFIX)
+	expression.RightParen = p.rparen(expression.Right)
+	return expression
+}
+
+func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
+	expression := &ast.InfixExpression{
+		Token:     p.curToken,
+		Operator:  p.curToken.Literal,
+		Left:      left,
+		LeftParen: p.lparen(left),
+	}
+	precedence := p.rightPrecedence()
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+	expression.RightParen = p.rparen(expression.Right)
 	return expression
 }
 
+// rightPrecedence is the precedence to parse the right operand of the
+// current operator with. a right associative operator takes one less, so an
+// operator of the same kind on the right binds first.
+func (p *Parser) rightPrecedence() int {
+	precedence := p.curPrecedence()
+	if rightAssociative[p.curToken.Type] {
+		precedence--
+	}
+	return precedence
+}
+
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:     p.curToken,
+		Operator:  p.curToken.Literal,
+		Target:    target,
+		LeftParen: p.lparen(target),
+	}
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.addError(InvalidAssignment, p.curToken, nil, "cannot assign to %s", target.String())
+	}
+	precedence := p.rightPrecedence()
+	p.nextToken()
+	expression.Value = p.parseExpression(precedence)
+	expression.RightParen = p.rparen(expression.Value)
+	return expression
+}
+
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+}
+
+// the parentheses only bump the precedence; they do not show up in the ast,
+// only in the span of the expression around them, see lparen and rparen
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	lparen := p.curToken
+	p.nextToken()
+	exp := p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if exp != nil {
+		p.parens[exp] = [2]token.Token{lparen, p.curToken}
+	}
+	return exp
+}
+
+// lparen is the ( that opens exp, if it was in parentheses
+func (p *Parser) lparen(exp ast.Expression) token.Token {
+	return p.parens[exp][0]
+}
+
+// rparen is the ) that closes exp, if it was in parentheses
+func (p *Parser) rparen(exp ast.Expression) token.Token {
+	return p.parens[exp][1]
+}
+
+func (p *Parser) parseIfExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Condition = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Alternative = p.parseBlockStatement()
+	}
+	return expression
+}
+
+// parseBlockStatement starts on the { and leaves curToken on the matching }
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+			p.nextToken()
+		}
+	}
+	if !p.curTokenIs(token.RBRACE) {
+		p.curErrors(token.RBRACE)
+	}
+	block.Rbrace = p.curToken
+	return block
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+
+	if !p.peekTokenIs(token.CATCH) && !p.peekTokenIs(token.FINALLY) {
+		// move off the }, or recovery would take it for the end of an enclosing block
+		p.nextToken()
+		p.addError(UnexpectedToken, p.curToken, []token.TokenType{token.CATCH, token.FINALLY},
+			"expected next token to be CATCH or FINALLY, got %s instead", p.curToken.Type)
+	}
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+	return expression
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	// a loop around the function does not make break valid inside it
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
+	lit.Body = p.parseBlockStatement()
+	return lit
+}
+
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return identifiers
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return identifiers
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.curToken, Function: function, LeftParen: p.lparen(function)}
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if exp.Arguments == nil {
+		return nil
+	}
+	exp.Rparen = p.curToken
+	return exp
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+	array.Rbracket = p.curToken
+	return array
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left, LeftParen: p.lparen(left)}
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	exp.Rbracket = p.curToken
+	return exp
+}
+
+// parseHashLiteral parses {key: value, ...}, keeping the pairs in source order
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken, Pairs: []ast.HashPair{}}
+	p.openHashes++
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+	p.openHashes--
+	hash.Rbrace = p.curToken
+	return hash
+}
+
+// parseExpressionList parses comma separated expressions up to the end
+// token, for call arguments and array elements. it starts on the opening
+// token and leaves curToken on the end token.
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseExpression(LOWEST))
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+	if !p.expectPeek(end) {
+		return nil
+	}
+	return list
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
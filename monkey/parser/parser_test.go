@@ -12,7 +12,7 @@ import (
 func TestLetStatements(t *testing.T) {
 	input := `let x = 5;
 let y = 10;
-let foobar = 838383;`
+let foobar = y;`
 
 	l := lexer.New(input)
 	p := New(l)
@@ -25,10 +25,11 @@ let foobar = 838383;`
 	}
 	tests := []struct {
 		expectedIdentifier string
+		expectedValue      string
 	}{
-		{"x"},
-		{"y"},
-		{"foobar"},
+		{"x", "5"},
+		{"y", "10"},
+		{"foobar", "y"},
 	}
 	for i, tt := range tests {
 		stmt := program.Statements[i]
@@ -36,6 +37,57 @@ let foobar = 838383;`
 		if !testLetStatements(t, stmt, tt.expectedIdentifier) {
 			return
 		}
+		value := stmt.(*ast.LetStatement).Value
+		if value == nil || value.String() != tt.expectedValue {
+			t.Fatalf("the let statement value should be %s, but got %v", tt.expectedValue, value)
+		}
+	}
+}
+
+func TestConstStatement(t *testing.T) {
+	l := lexer.New("const answer = 6 * 7;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expect 1 statement, got %d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("cannot convert to let statement, got %T", program.Statements[0])
+	}
+	if stmt.Token.Type != token.CONST {
+		t.Errorf("the token type should be CONST, got %s", stmt.Token.Type)
+	}
+	if stmt.String() != "const answer = (6 * 7);" {
+		t.Errorf("wrong string, got %q", stmt.String())
+	}
+}
+
+func TestStatementsWithoutSemicolon(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1 + 2", "let x = (1 + 2);"},
+		{"return x * y", "return (x * y);"},
+		{"let x = 1\nlet y = x", "let x = 1;let y = x;"},
+		{"return 5\nx", "return 5;x"},
+		{"return;", "return;"},
+		{"return", "return;"},
+		{"fn() { if (x) { return } 1 }", "fn() ifx return;1"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
 	}
 }
 
@@ -85,7 +137,8 @@ return 992233;
 		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
 	}
 
-	for _, stmt := range program.Statements {
+	expectedValues := []int64{5, 10, 992233}
+	for i, stmt := range program.Statements {
 		rtStat, ok := stmt.(*ast.ReturnStatement)
 		if !ok {
 			t.Errorf("stmt not *ast.returnStatement. got=%T", stmt)
@@ -94,6 +147,7 @@ return 992233;
 		if rtStat.TokenLiteral() != "return" {
 			t.Errorf("return statement.TokenLiteral is not 'return', but %s", rtStat.TokenLiteral())
 		}
+		testIntegerLiteral(t, rtStat.ReturnValue, expectedValues[i])
 	}
 }
 
@@ -249,3 +303,559 @@ func TestParsingInfixEXpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestOperatorPrecedenceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"-a * b", "((-a) * b)"},
+		{"!-a", "(!(-a))"},
+		{"a + b + c", "((a + b) + c)"},
+		{"a + b - c", "((a + b) - c)"},
+		{"a * b * c", "((a * b) * c)"},
+		{"a * b / c", "((a * b) / c)"},
+		{"a + b / c", "(a + (b / c))"},
+		{"5 + 5 * 2", "(5 + (5 * 2))"},
+		{"a + b * c + d / e - f", "(((a + (b * c)) + (d / e)) - f)"},
+		{"3 + 4; -5 * 5", "(3 + 4)((-5) * 5)"},
+		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))"},
+		{"5 < 4 != 3 > 4", "((5 < 4) != (3 > 4))"},
+		{"3 + 4 * 5 == 3 * 1 + 4 * 5", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))"},
+		{"true", "true"},
+		{"3 > 5 == false", "((3 > 5) == false)"},
+		{"3 < 5 == true", "((3 < 5) == true)"},
+		{"1 + (2 + 3) + 4", "((1 + (2 + 3)) + 4)"},
+		{"(5 + 5) * 2", "((5 + 5) * 2)"},
+		{"2 / (5 + 5)", "(2 / (5 + 5))"},
+		{"-(5 + 5)", "(-(5 + 5))"},
+		{"!(true == true)", "(!(true == true))"},
+		{"a + add(b * c) + d", "((a + add((b * c))) + d)"},
+		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))", "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))"},
+		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
+		{"a <= b == b >= c", "((a <= b) == (b >= c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a == b && c != d", "((a == b) && (c != d))"},
+		{"a + b % c", "(a + (b % c))"},
+		{"a * b ** c", "(a * (b ** c))"},
+		{"a ** b ** c", "(a ** (b ** c))"},
+		{"-a ** b", "(-(a ** b))"},
+		{"a ** -b", "(a ** (-b))"},
+		{"f(a) ** 2", "(f(a) ** 2)"},
+		{"x += 1 + 2", "(x += (1 + 2))"},
+		{"x -= y += 2", "(x -= (y += 2))"},
+		{"x += a || b", "(x += (a || b))"},
+		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"-a[0] ** 2", "(-((a[0]) ** 2))"},
+		{"f(x)[0]", "(f(x)[0])"},
+		{"x = y = z", "(x = (y = z))"},
+		{"x = a || b", "(x = (a || b))"},
+		{"a[0] = 1 + 2", "((a[0]) = (1 + 2))"},
+		{"h[k][0] += 1", "(((h[k])[0]) += 1)"},
+		{"x = y += 2", "(x = (y += 2))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+}
+
+func parseSingleExpression(t *testing.T, input string) ast.Expression {
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expect 1 statement, got %d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("cannot convert to expression statement, got %T", program.Statements[0])
+	}
+	return stmt.Expression
+}
+
+func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok {
+		t.Errorf("cannot convert to *ast.Identifier, got %T", exp)
+		return false
+	}
+	if ident.Value != value {
+		t.Errorf("identifier value is wrong. expect %s, got %s", value, ident.Value)
+		return false
+	}
+	return true
+}
+
+func TestBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true;", true},
+		{"false;", false},
+	}
+
+	for _, tt := range tests {
+		exp := parseSingleExpression(t, tt.input)
+		boolean, ok := exp.(*ast.Boolean)
+		if !ok {
+			t.Fatalf("cannot convert to *ast.Boolean, got %T", exp)
+		}
+		if boolean.Value != tt.expected {
+			t.Errorf("boolean value is wrong. expect %t, got %t", tt.expected, boolean.Value)
+		}
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	exp := parseSingleExpression(t, `if (x < y) { x }`)
+	ifExp, ok := exp.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("cannot convert to *ast.IfExpression, got %T", exp)
+	}
+	if ifExp.Condition.String() != "(x < y)" {
+		t.Errorf("wrong condition, got %s", ifExp.Condition.String())
+	}
+	if len(ifExp.Consequence.Statements) != 1 {
+		t.Fatalf("consequence should have 1 statement, got %d", len(ifExp.Consequence.Statements))
+	}
+	consequence, ok := ifExp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("cannot convert to expression statement, got %T", ifExp.Consequence.Statements[0])
+	}
+	testIdentifier(t, consequence.Expression, "x")
+	if ifExp.Alternative != nil {
+		t.Errorf("alternative should be nil, got %+v", ifExp.Alternative)
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	exp := parseSingleExpression(t, `if (x < y) { x } else { if (y) { y } else { let z = 1; z } }`)
+	ifExp, ok := exp.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("cannot convert to *ast.IfExpression, got %T", exp)
+	}
+	if ifExp.Alternative == nil {
+		t.Fatalf("alternative should not be nil")
+	}
+	if len(ifExp.Alternative.Statements) != 1 {
+		t.Fatalf("alternative should have 1 statement, got %d", len(ifExp.Alternative.Statements))
+	}
+	expected := "if(x < y) xelse ify yelse let z = 1;z"
+	if ifExp.String() != expected {
+		t.Errorf("expected %q, got %q", expected, ifExp.String())
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	exp := parseSingleExpression(t, `fn(x, y) { x + y; }`)
+	function, ok := exp.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("cannot convert to *ast.FunctionLiteral, got %T", exp)
+	}
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function should have 2 parameters, got %d", len(function.Parameters))
+	}
+	testIdentifier(t, function.Parameters[0], "x")
+	testIdentifier(t, function.Parameters[1], "y")
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function body should have 1 statement, got %d", len(function.Body.Statements))
+	}
+	if function.Body.String() != "(x + y)" {
+		t.Errorf("wrong function body, got %s", function.Body.String())
+	}
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{"fn() {};", []string{}},
+		{"fn(x) {};", []string{"x"}},
+		{"fn(x, y, z) {};", []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		exp := parseSingleExpression(t, tt.input)
+		function := exp.(*ast.FunctionLiteral)
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("expect %d parameters, got %d", len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testIdentifier(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestFunctionLiteralName(t *testing.T) {
+	stmts := parseStatements(t, "let add = fn(a, b) { a + b }; const f = fn() { fn() {} };")
+	for i, name := range []string{"add", "f"} {
+		fn := stmts[i].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+		if fn.Name != name {
+			t.Errorf("expected function name %q, got %q", name, fn.Name)
+		}
+	}
+	inner := stmts[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Body.Statements[0]
+	if name := inner.(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral).Name; name != "" {
+		t.Errorf("a function that is not bound should have no name, got %q", name)
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	exp := parseSingleExpression(t, "add(1, 2 * 3, fn(x) { x }(4));")
+	call, ok := exp.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("cannot convert to *ast.CallExpression, got %T", exp)
+	}
+	testIdentifier(t, call.Function, "add")
+	if len(call.Arguments) != 3 {
+		t.Fatalf("expect 3 arguments, got %d", len(call.Arguments))
+	}
+	testIntegerLiteral(t, call.Arguments[0], 1)
+	if call.Arguments[1].String() != "(2 * 3)" {
+		t.Errorf("wrong second argument, got %s", call.Arguments[1].String())
+	}
+	if call.Arguments[2].String() != "fn(x) x(4)" {
+		t.Errorf("wrong third argument, got %s", call.Arguments[2].String())
+	}
+}
+
+func TestArrayLiteralParsing(t *testing.T) {
+	exp := parseSingleExpression(t, "[1, 2 * 2, 3 + 3]")
+	array, ok := exp.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("cannot convert to *ast.ArrayLiteral, got %T", exp)
+	}
+	if len(array.Elements) != 3 {
+		t.Fatalf("expect 3 elements, got %d", len(array.Elements))
+	}
+	testIntegerLiteral(t, array.Elements[0], 1)
+	if array.Elements[1].String() != "(2 * 2)" {
+		t.Errorf("wrong second element, got %s", array.Elements[1].String())
+	}
+	if array.Elements[2].String() != "(3 + 3)" {
+		t.Errorf("wrong third element, got %s", array.Elements[2].String())
+	}
+
+	exp = parseSingleExpression(t, "[]")
+	array, ok = exp.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("cannot convert to *ast.ArrayLiteral, got %T", exp)
+	}
+	if len(array.Elements) != 0 {
+		t.Errorf("expect no elements, got %d", len(array.Elements))
+	}
+}
+
+func TestHashLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, `{}`},
+		{`{"one": 1, "two": 2, "three": 3}`, `{"one": 1, "two": 2, "three": 3}`},
+		{`{true: 1, 2: "b",}`, `{true: 1, 2: "b"}`},
+		{`{"one": 0 + 1, "two": 10 - 8}`, `{"one": (0 + 1), "two": (10 - 8)}`},
+		{`{"a": {"b": [1]}}["a"]`, `({"a": {"b": [1]}}["a"])`},
+		{`let h = {1: 2}; if (h) { h }`, `let h = {1: 2};ifh h`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	exp := parseSingleExpression(t, `{"one": 1, "two": 2}`)
+	hash, ok := exp.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("cannot convert to *ast.HashLiteral, got %T", exp)
+	}
+	if len(hash.Pairs) != 2 {
+		t.Fatalf("expect 2 pairs, got %d", len(hash.Pairs))
+	}
+	testIntegerLiteral(t, hash.Pairs[1].Value, 2)
+	if hash.End().Offset != len(`{"one": 1, "two": 2}`) {
+		t.Errorf("hash literal should end after the }, got %d", hash.End().Offset)
+	}
+}
+
+func TestIndexExpressionParsing(t *testing.T) {
+	exp := parseSingleExpression(t, "myArray[1 + 1]")
+	index, ok := exp.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("cannot convert to *ast.IndexExpression, got %T", exp)
+	}
+	testIdentifier(t, index.Left, "myArray")
+	if index.Index.String() != "(1 + 1)" {
+		t.Errorf("wrong index, got %s", index.Index.String())
+	}
+	if index.End().Offset != len("myArray[1 + 1]") {
+		t.Errorf("index expression should end after the ], got %d", index.End().Offset)
+	}
+}
+
+func TestLoopParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x += 1 }", "while ((x < 10)) {(x += 1)}"},
+		{"while (true) { break; }", "while (true) {break;}"},
+		{"for (x in [1, 2]) { continue; x }", "for (x in [1, 2]) {continue;x}"},
+		{"for (k in h) { while (k) { break } }", "for (k in h) {while (k) {break;}}"},
+		{"while (a) { if (b) { continue } }", "while (a) {ifb continue;}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	exp := parseStatements(t, "for (item in items) { item }")
+	stmt, ok := exp[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("cannot convert to *ast.ForStatement, got %T", exp[0])
+	}
+	testIdentifier(t, stmt.Variable, "item")
+	testIdentifier(t, stmt.Iterable, "items")
+	if len(stmt.Body.Statements) != 1 {
+		t.Errorf("expect 1 statement in the body, got %d", len(stmt.Body.Statements))
+	}
+}
+
+func TestTryParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "boom";`, `throw "boom";`},
+		{`throw {"code": 1}`, `throw {"code": 1};`},
+		{"try { f() } catch (e) { e }", "try {f()} catch (e) {e}"},
+		{"try { f() } finally { g() }", "try {f()} finally {g()}"},
+		{"try { f() } catch (err) { throw err } finally { g() }", "try {f()} catch (err) {throw err;} finally {g()}"},
+		{"let x = try { 1 } catch (e) { 2 };", "let x = try {1} catch (e) {2};"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	stmts := parseStatements(t, "try { a } catch (e) { b; c }")
+	try, ok := stmts[0].(*ast.ExpressionStatement).Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("cannot convert to *ast.TryExpression, got %T", stmts[0])
+	}
+	testIdentifier(t, try.Param, "e")
+	if len(try.Catch.Statements) != 2 || try.Finally != nil {
+		t.Errorf("wrong catch and finally blocks, got %s", try.String())
+	}
+}
+
+func parseStatements(t *testing.T, input string) []ast.Statement {
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	return program.Statements
+}
+
+func TestUnterminatedBlock(t *testing.T) {
+	l := lexer.New("if (x) { x")
+	p := New(l)
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected an error for the missing }")
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(1, 2 * 3);`
+
+	l := lexer.NewFile("test.monkey", input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+
+	tests := []struct {
+		node        ast.Node
+		expectedPos string
+		expectedEnd string
+	}{
+		{program, "test.monkey:1:1", "test.monkey:4:14"},
+		{let, "test.monkey:1:1", "test.monkey:3:2"},
+		{fn, "test.monkey:1:11", "test.monkey:3:2"},
+		{fn.Body, "test.monkey:1:20", "test.monkey:3:2"},
+		{body, "test.monkey:2:3", "test.monkey:2:8"},
+		{call, "test.monkey:4:1", "test.monkey:4:14"},
+		{call.Arguments[1], "test.monkey:4:8", "test.monkey:4:13"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expectedPos {
+			t.Errorf("tests[%d] %T: expected pos %s, got %s", i, tt.node, tt.expectedPos, tt.node.Pos())
+		}
+		if tt.node.End().String() != tt.expectedEnd {
+			t.Errorf("tests[%d] %T: expected end %s, got %s", i, tt.node, tt.expectedEnd, tt.node.End())
+		}
+	}
+}
+
+// the parentheses are not in the ast, but the span of what is around them
+// takes them in
+func TestGroupedPositions(t *testing.T) {
+	input := `(a + b) * c;
+c * ((a));
+-(x);
+(f)(1)[(0)];`
+
+	l := lexer.NewFile("test.monkey", input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expression := func(i int) ast.Expression {
+		return program.Statements[i].(*ast.ExpressionStatement).Expression
+	}
+	index := expression(3).(*ast.IndexExpression)
+
+	tests := []struct {
+		node        ast.Node
+		expectedPos string
+		expectedEnd string
+	}{
+		{expression(0), "test.monkey:1:1", "test.monkey:1:12"},
+		{expression(1), "test.monkey:2:1", "test.monkey:2:10"},
+		{expression(2), "test.monkey:3:1", "test.monkey:3:5"},
+		{index, "test.monkey:4:1", "test.monkey:4:12"},
+		{index.Left, "test.monkey:4:1", "test.monkey:4:7"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expectedPos {
+			t.Errorf("tests[%d] %T: expected pos %s, got %s", i, tt.node, tt.expectedPos, tt.node.Pos())
+		}
+		if tt.node.End().String() != tt.expectedEnd {
+			t.Errorf("tests[%d] %T: expected end %s, got %s", i, tt.node, tt.expectedEnd, tt.node.End())
+		}
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	exp := parseSingleExpression(t, `"hello \"world\"";`)
+	literal, ok := exp.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("cannot convert to *ast.StringLiteral, got %T", exp)
+	}
+	if literal.Value != `hello "world"` {
+		t.Errorf("literal value is wrong, got %q", literal.Value)
+	}
+	if literal.String() != `"hello \"world\""` {
+		t.Errorf("literal string is wrong, got %s", literal.String())
+	}
+}
+
+// a printed program has to parse back to the same strings
+func TestStringLiteralRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"plain"`, `"plain"`},
+		{`"tab\t \"q\" \\ \r\n"`, `"tab\t \"q\" \\ \r\n"`},
+		{`"nul\u{0} bell\u{7}"`, `"nul\u{0} bell\u{7}"`},
+		{`"\u{1f600} é 日本"`, `"😀 é 日本"`},
+		{`"\u{202e}"`, `"\u{202e}"`},
+	}
+
+	for _, tt := range tests {
+		first := parseSingleExpression(t, tt.input).(*ast.StringLiteral)
+		if first.String() != tt.expected {
+			t.Errorf("wrong string for %s. want=%s, got=%s", tt.input, tt.expected, first.String())
+		}
+		second := parseSingleExpression(t, first.String()).(*ast.StringLiteral)
+		if second.Value != first.Value {
+			t.Errorf("%s does not parse back. want=%q, got=%q", first.String(), first.Value, second.Value)
+		}
+	}
+}
+
+func TestNumberLiteralValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0xFF", int64(255)},
+		{"0o17", int64(15)},
+		{"0b1010", int64(10)},
+		{"1_000_000", int64(1000000)},
+		{"9223372036854775807", int64(9223372036854775807)},
+		{"3.14", 3.14},
+		{"1e3", 1000.0},
+		{"2.5E-3", 0.0025},
+		{"1_000.5", 1000.5},
+	}
+
+	for _, tt := range tests {
+		exp := parseSingleExpression(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int64:
+			lit, ok := exp.(*ast.IntegerLiteral)
+			if !ok {
+				t.Errorf("%s: cannot convert to *ast.IntegerLiteral, got %T", tt.input, exp)
+				continue
+			}
+			if lit.Value != expected {
+				t.Errorf("%s: expected %d, got %d", tt.input, expected, lit.Value)
+			}
+		case float64:
+			lit, ok := exp.(*ast.FloatLiteral)
+			if !ok {
+				t.Errorf("%s: cannot convert to *ast.FloatLiteral, got %T", tt.input, exp)
+				continue
+			}
+			if lit.Value != expected {
+				t.Errorf("%s: expected %g, got %g", tt.input, expected, lit.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"github.com/fandan-nyc/all-interpretors/monkey/ast"
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+// panic-mode recovery: addError panics with bailout, which unwinds to the
+// innermost parseStatement. the broken statement is dropped and the parser
+// skips ahead to a statement boundary, so one mistake gives one error instead
+// of a cascade of follow-on errors. at the end of the input there is nothing
+// to skip to, so there the blocks left open unwind without an error each.
+
+// the parser stops after this many errors
+const maxErrors = 10
+
+// bailout abandons the statement being parsed
+type bailout struct{}
+
+// errorLimit abandons the whole program once maxErrors is reached
+type errorLimit struct{}
+
+// openHashes is p.openHashes when the statement started, so the hash
+// literals left open by the broken statement can be skipped as a whole
+func (p *Parser) recoverStatement(start token.Token, openHashes int, stmt *ast.Statement) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if _, ok := r.(bailout); !ok {
+		panic(r)
+	}
+	*stmt = nil
+	depth := p.openHashes - openHashes
+	p.openHashes = openHashes
+	p.synchronize(start, depth)
+}
+
+func (p *Parser) recoverErrorLimit() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if _, ok := r.(errorLimit); !ok {
+		panic(r)
+	}
+}
+
+// synchronize skips the rest of the statement that started at start. it stops
+// right after a semicolon, or on a statement keyword or on the } that closes
+// the enclosing block, so the caller can go on from there.
+// braces opened inside the broken statement are skipped as a whole, depth
+// is the number of braces that were already open when the error was found.
+func (p *Parser) synchronize(start token.Token, depth int) {
+	for !p.curTokenIs(token.EOF) {
+		atStart := p.curToken.Pos == start.Pos
+		switch p.curToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth > 0 {
+				depth--
+				break
+			}
+			// a stray } is the broken statement itself, skip just that
+			if atStart {
+				p.nextToken()
+			}
+			return
+		case token.SEMICOLON:
+			if depth == 0 {
+				p.nextToken()
+				return
+			}
+		case token.LET, token.CONST, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.THROW:
+			if depth == 0 && !atStart {
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
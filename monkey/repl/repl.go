@@ -3,25 +3,48 @@ package repl
 import (
 	"bufio"
 	"fmt"
-	"github.com/fandan-nyc/all-interpretors/monkey/lexer"
-	"github.com/fandan-nyc/all-interpretors/monkey/token"
 	"io"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/evaluator"
+	"github.com/fandan-nyc/all-interpretors/monkey/lexer"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+	"github.com/fandan-nyc/all-interpretors/monkey/parser"
 )
 
 const PROMPT = ">> "
 
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
+	// the environment outlives a single line, so `let` bindings are visible later
+	env := object.NewEnvironment()
 	for {
-		fmt.Printf(PROMPT)
+		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
 		if !scanned {
 			return
 		}
 		line := scanner.Text()
 		l := lexer.New(line)
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+		p := parser.New(l)
+
+		program := p.ParseProgram()
+		if errs := p.ParseErrors(); len(errs) != 0 {
+			printParserErrors(out, line, errs)
+			continue
+		}
+
+		evaluated := evaluator.Eval(program, env)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			fmt.Fprintln(out, errObj.Trace())
+			continue
+		}
+		if evaluated != nil {
+			fmt.Fprintln(out, evaluated.Inspect())
 		}
 	}
 }
+
+func printParserErrors(out io.Writer, line string, errs parser.ErrorList) {
+	fmt.Fprintln(out, "parser errors:")
+	fmt.Fprintln(out, errs.Render(line))
+}
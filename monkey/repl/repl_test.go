@@ -0,0 +1,32 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2\n", ">> 3\n>> "},
+		{"let x = 5;\nx * 2\n", ">> >> 10\n>> "},
+		{"let add = fn(a, b) { a + b };\nadd(1, 2)\n", ">> >> 3\n>> "},
+		{"5 + true\n", ">> ERROR: type mismatch: INTEGER + BOOLEAN\n\n<main>\n\t1:1\n>> "},
+		{
+			"let f = fn(x) { x + true };\n\nf(1)\n",
+			">> >> >> ERROR: type mismatch: INTEGER + BOOLEAN\n\nf()\n\t1:17\n<main>\n\t1:1\n>> ",
+		},
+		{"let x 5\n", ">> parser errors:\n1:7: expected next token to be =, got INT instead\nlet x 5\n      ^\n>> "},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+		if out.String() != tt.expected {
+			t.Errorf("input %q: expected %q, got %q", tt.input, tt.expected, out.String())
+		}
+	}
+}
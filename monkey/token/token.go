@@ -1,10 +1,51 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // position of the first char of the token
+	End     Position // position right after the last char of the token
+
+	// comments between the previous token and this one. the lexer only
+	// fills this in KeepComments mode.
+	Comments []Comment
+}
+
+// Comment is a // or /* */ comment, Text includes the comment markers
+type Comment struct {
+	Text string
+	Pos  Position
+}
+
+// Position is a location in the source. Line and Column are 1-based,
+// Offset is the 0-based byte offset into the input.
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+// a zero Position, e.g. on a token built by hand, is not valid
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// String renders the position as file:line:column, leaving out whatever is unknown
+func (p Position) String() string {
+	s := p.Filename
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
 }
 
 const (
@@ -12,8 +53,10 @@ const (
 	EOF     = "EOF"
 
 	// identifier
-	IDENT = "IDENT"
-	INT   = "INT"
+	IDENT  = "IDENT"
+	INT    = "INT"
+	FLOAT  = "FLOAT"
+	STRING = "STRING"
 
 	// operator
 	ASSIGN   = "="
@@ -22,40 +65,74 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+	POWER    = "**"
 
-	LT = "<"
-	GT = ">"
+	PLUS_ASSIGN  = "+="
+	MINUS_ASSIGN = "-="
+
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
 
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR  = "||"
+
 	// delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
 
 	LPAREN = "("
 	RPAREN = ")"
 	LBRACE = "{"
 	RBRACE = "}"
 
+	LBRACKET = "["
+	RBRACKET = "]"
+
 	// keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	RETURN   = "RETURN"
 	IF       = "IF"
 	ELSE     = "ELSE"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"return": RETURN,
-	"if":     IF,
-	"else":   ELSE,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"const":    CONST,
+	"true":     TRUE,
+	"false":    FALSE,
+	"return":   RETURN,
+	"if":       IF,
+	"else":     ELSE,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"throw":    THROW,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
 }
 
 func LookupIdent(ident string) TokenType {
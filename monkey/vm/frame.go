@@ -0,0 +1,28 @@
+package vm
+
+import (
+	"github.com/fandan-nyc/all-interpretors/monkey/code"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+	"github.com/fandan-nyc/all-interpretors/monkey/token"
+)
+
+// Frame is a call in progress. its locals are on the stack, starting at
+// basePointer.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// pos is where the instruction being executed came from
+func (f *Frame) pos() token.Position {
+	return f.cl.Fn.Lines.Lookup(f.ip)
+}
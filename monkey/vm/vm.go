@@ -0,0 +1,530 @@
+// Package vm runs the bytecode of the compiler. it gives the same results and
+// the same errors as the evaluator.
+package vm
+
+import (
+	"fmt"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/code"
+	"github.com/fandan-nyc/all-interpretors/monkey/compiler"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+)
+
+// StackSize is the size the stack starts with. it grows on demand up to
+// MaxStackSize, and calls nest up to MaxFrames deep
+const StackSize = 2048
+const MaxStackSize = 1 << 20
+const GlobalsSize = 65536
+const MaxFrames = 1 << 16
+
+var NULL = object.NULL
+var TRUE = object.TRUE
+var FALSE = object.FALSE
+
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // always points to the next free slot. the top of the stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	handlers []handler // the try blocks in effect, innermost last
+
+	lastPopped object.Object
+}
+
+// handler is a try block in effect: where its catch code starts, and the
+// frame and stack height to go back to when it catches an error
+type handler struct {
+	catchIP    int
+	frameIndex int
+	sp         int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Lines:        bytecode.Lines,
+		NumLocals:    bytecode.NumLocals,
+		LocalNames:   bytecode.LocalNames,
+	}
+	stackSize := StackSize
+	for stackSize < mainFn.NumLocals {
+		stackSize *= 2
+	}
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		globalNames: bytecode.GlobalNames,
+		stack:       make([]object.Object, stackSize),
+		sp:          mainFn.NumLocals, // the locals of the top level
+		frames:      []*Frame{NewFrame(&object.Closure{Fn: mainFn}, 0)},
+		framesIndex: 1,
+	}
+}
+
+// NewWithGlobalsStore keeps the globals of an earlier run, for the REPL
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// LastPoppedStackElem is the value of the last expression statement, or
+// what the top level returned
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPopped
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Run executes the program. an error that nothing catches stops it and is
+// returned as an *object.Error.
+func (vm *VM) Run() error {
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		frame := vm.currentFrame()
+		ip := frame.ip
+		ins := frame.Instructions()
+		op := code.Opcode(ins[ip])
+
+		var err *object.Error
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpLessEqual,
+			code.OpGreaterThan, code.OpGreaterEqual:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(object.InfixOperation(operators[op], left, right))
+
+		case code.OpMinus:
+			err = vm.pushResult(object.PrefixOperation("-", vm.pop()))
+
+		case code.OpBang:
+			err = vm.pushResult(object.PrefixOperation("!", vm.pop()))
+
+		case code.OpTrue:
+			err = vm.push(TRUE)
+
+		case code.OpFalse:
+			err = vm.push(FALSE)
+
+		case code.OpNull:
+			err = vm.push(NULL)
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if !object.IsTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			err = vm.pushVariable(vm.globals[globalIndex], vm.globalNames, int(globalIndex))
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			err = vm.pushVariable(vm.stack[frame.basePointer+localIndex], frame.cl.Fn.LocalNames, localIndex)
+
+		case code.OpSetLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			vm.stack[frame.basePointer+localIndex] = vm.pop()
+
+		case code.OpGetCell:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			value := vm.stack[frame.basePointer+localIndex]
+			if cell, ok := value.(*object.Cell); ok {
+				value = cell.Value
+			}
+			err = vm.pushVariable(value, frame.cl.Fn.LocalNames, localIndex)
+
+		case code.OpSetCell:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			vm.localCell(localIndex).Value = vm.pop()
+
+		case code.OpLoadCell:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			err = vm.push(vm.localCell(localIndex))
+
+		case code.OpResetLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			vm.stack[frame.basePointer+localIndex] = nil
+
+		case code.OpGetFree:
+			freeIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			err = vm.pushVariable(frame.cl.Free[freeIndex].Value, frame.cl.Fn.FreeNames, freeIndex)
+
+		case code.OpSetFree:
+			freeIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			frame.cl.Free[freeIndex].Value = vm.pop()
+
+		case code.OpLoadFree:
+			freeIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			err = vm.push(frame.cl.Free[freeIndex])
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			err = vm.push(object.Builtins[builtinIndex].Builtin)
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+			err = vm.push(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			hash := vm.buildHash(vm.sp-numElements, vm.sp)
+			vm.sp -= numElements
+			err = vm.pushResult(hash)
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(object.Index(left, index))
+
+		case code.OpSetIndex:
+			operator := code.Opcode(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(object.SetIndex(left, index, value, operators[operator]))
+
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			err = vm.executeCall(numArgs)
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if vm.framesIndex == 1 {
+				// a return at the top level ends the program
+				vm.lastPopped = returnValue
+				return nil
+			}
+			vm.leaveFrame()
+			err = vm.push(returnValue)
+
+		case code.OpReturn:
+			if vm.framesIndex == 1 {
+				return nil
+			}
+			vm.leaveFrame()
+			err = vm.push(NULL)
+
+		case code.OpClosure:
+			constIndex := int(code.ReadUint16(ins[ip+1:]))
+			numFree := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+			err = vm.pushClosure(constIndex, numFree)
+
+		case code.OpIter:
+			err = vm.pushResult(newIterator(vm.pop()))
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			it, ok := vm.pop().(*iterator)
+			if !ok {
+				// only a hand made .mkc file gets here
+				err = object.NewError("not an iterator")
+			} else if it.next < len(it.items) {
+				err = vm.push(it.items[it.next])
+				it.next++
+			} else {
+				frame.ip = pos - 1
+			}
+
+		case code.OpThrow:
+			err = object.ThrownError(vm.pop())
+
+		case code.OpTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			vm.handlers = append(vm.handlers, handler{catchIP: pos, frameIndex: vm.framesIndex - 1, sp: vm.sp})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		default:
+			return fmt.Errorf("opcode %d undefined", op)
+		}
+
+		if err != nil && !vm.throw(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// throw unwinds to the innermost try block and hands it the error. every
+// frame it leaves on the way is recorded in the error's stack, like the
+// evaluator does. it reports false when nothing catches the error.
+func (vm *VM) throw(err *object.Error) bool {
+	if !err.Pos.IsValid() {
+		err.Pos = vm.currentFrame().pos()
+	}
+	for {
+		if n := len(vm.handlers); n > 0 && vm.handlers[n-1].frameIndex == vm.framesIndex-1 {
+			h := vm.handlers[n-1]
+			vm.handlers = vm.handlers[:n-1]
+			vm.sp = h.sp
+			vm.currentFrame().ip = h.catchIP - 1
+			vm.push(&object.Exception{Error: err})
+			return true
+		}
+		if vm.framesIndex == 1 {
+			return false
+		}
+		frame := vm.popFrame()
+		vm.sp = frame.basePointer - 1
+		err.Stack = append(err.Stack, object.Frame{Function: frame.cl.Fn.Name, CallSite: vm.currentFrame().pos()})
+	}
+}
+
+func (vm *VM) push(o object.Object) *object.Error {
+	if err := vm.ensureStack(vm.sp + 1); err != nil {
+		return err
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+	return nil
+}
+
+// ensureStack grows the stack to hold at least size slots
+func (vm *VM) ensureStack(size int) *object.Error {
+	if size <= len(vm.stack) {
+		return nil
+	}
+	if size > MaxStackSize {
+		return object.NewError("stack overflow")
+	}
+	newSize := len(vm.stack) * 2
+	for newSize < size {
+		newSize *= 2
+	}
+	if newSize > MaxStackSize {
+		newSize = MaxStackSize
+	}
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+	return nil
+}
+
+// pushResult pushes the result of an operation, or passes on its error
+func (vm *VM) pushResult(o object.Object) *object.Error {
+	if err, ok := o.(*object.Error); ok {
+		return err
+	}
+	return vm.push(o)
+}
+
+// pushVariable pushes the value of a variable, which is nil when it has not
+// been set yet
+func (vm *VM) pushVariable(value object.Object, names []string, index int) *object.Error {
+	if value == nil {
+		name := ""
+		if index < len(names) {
+			name = names[index]
+		}
+		return object.NewError("identifier not found: " + name)
+	}
+	return vm.push(value)
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// localCell gives the cell of a captured local, and creates it the first
+// time. a parameter only becomes a cell here, it is passed as a plain value.
+func (vm *VM) localCell(localIndex int) *object.Cell {
+	slot := &vm.stack[vm.currentFrame().basePointer+localIndex]
+	if cell, ok := (*slot).(*object.Cell); ok {
+		return cell
+	}
+	cell := &object.Cell{Value: *slot}
+	*slot = cell
+	return cell
+}
+
+// leaveFrame returns from the current frame, dropping its locals and the
+// function being called. any try block of the frame is over as well.
+func (vm *VM) leaveFrame() {
+	frame := vm.popFrame()
+	vm.sp = frame.basePointer - 1
+	for n := len(vm.handlers); n > 0 && vm.handlers[n-1].frameIndex >= vm.framesIndex; n-- {
+		vm.handlers = vm.handlers[:n-1]
+	}
+}
+
+func (vm *VM) executeCall(numArgs int) *object.Error {
+	switch callee := vm.stack[vm.sp-1-numArgs].(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return object.NewError("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	if numArgs != cl.Fn.NumParameters {
+		return object.NewError("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+	basePointer := vm.sp - numArgs
+	if vm.framesIndex >= MaxFrames {
+		return object.NewError("stack overflow")
+	}
+	if err := vm.ensureStack(basePointer + cl.Fn.NumLocals); err != nil {
+		return err
+	}
+	// the slots may still hold values of an earlier call
+	for i := vm.sp; i < basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+	vm.pushFrame(NewFrame(cl, basePointer))
+	vm.sp = basePointer + cl.Fn.NumLocals
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) *object.Error {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp = vm.sp - numArgs - 1
+
+	result := builtin.Fn(args...)
+	if result == nil {
+		result = NULL
+	}
+	return vm.pushResult(result)
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) *object.Error {
+	function, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return object.NewError("not a function: %+v", vm.constants[constIndex])
+	}
+	free := make([]*object.Cell, numFree)
+	for i := 0; i < numFree; i++ {
+		cell, ok := vm.stack[vm.sp-numFree+i].(*object.Cell)
+		if !ok {
+			// as with iterators, only a hand made .mkc file gets here
+			return object.NewError("not a variable to capture")
+		}
+		free[i] = cell
+	}
+	vm.sp -= numFree
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+// the pairs are in source order. a key written twice keeps its first
+// position and its last value.
+func (vm *VM) buildHash(startIndex, endIndex int) object.Object {
+	hash := object.NewHash()
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return object.NewError("unusable as hash key: %s", key.Type())
+		}
+		hash.Set(hashKey, vm.stack[i+1])
+	}
+	return hash
+}
+
+// iterator is a for loop in progress. the items are taken up front, so
+// changing the iterable inside the loop does not change what is iterated.
+type iterator struct {
+	items []object.Object
+	next  int
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+// newIterator goes over the elements of an array, the keys of a hash or
+// the characters of a string
+func newIterator(iterable object.Object) object.Object {
+	items, err := object.IterationItems(iterable)
+	if err != nil {
+		return err
+	}
+	return &iterator{items: items}
+}
+
+// operators names the operation of an opcode for the shared operator code.
+// OpSetIndex without an operation reads 0, which gives the empty name.
+var operators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpPow:          "**",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+}
@@ -0,0 +1,414 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fandan-nyc/all-interpretors/monkey/ast"
+	"github.com/fandan-nyc/all-interpretors/monkey/compiler"
+	"github.com/fandan-nyc/all-interpretors/monkey/evaluator"
+	"github.com/fandan-nyc/all-interpretors/monkey/lexer"
+	"github.com/fandan-nyc/all-interpretors/monkey/object"
+	"github.com/fandan-nyc/all-interpretors/monkey/parser"
+)
+
+// every case runs on the evaluator and on the vm, and both have to give
+// the expected result: the value inspected, or the error
+type vmTestCase struct {
+	input    string
+	expected string
+}
+
+func TestArithmetic(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{"1", "1"},
+		{"1 + 2 * 3 - 4 / 2", "5"},
+		{"-5 + 10 % 3", "-4"},
+		{"2 ** 10", "1024"},
+		{"2 ** -1", "0.5"},
+		{"1.5 + 1", "2.5"},
+		{"7 / 2.0", "3.5"},
+		{"-1.5", "-1.5"},
+		{"1 / 0", "ERROR: division by zero"},
+		{"5 % 0", "ERROR: division by zero"},
+		{"-true", "ERROR: unknown operator: -BOOLEAN"},
+		{"5 + true", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{"true + false", "ERROR: unknown operator: BOOLEAN + BOOLEAN"},
+		{`"a" - "b"`, "ERROR: unknown operator: STRING - STRING"},
+	})
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{"true", "true"},
+		{"1 < 2", "true"},
+		{"1 >= 2", "false"},
+		{"1 == 1.0", "true"},
+		{"true != false", "true"},
+		{`"a" < "b"`, "true"},
+		{`"a" + "b" == "ab"`, "true"},
+		{"!5", "false"},
+		{"!!true", "true"},
+		{"!(if (false) { 5; })", "true"},
+		{"1 && 0", "true"},
+		{"false && x", "false"},
+		{"true || x", "true"},
+		{"false || 0", "true"},
+		{"false || if (false) { 1 }", "false"},
+		{"null == null", "ERROR: identifier not found: null"},
+	})
+}
+
+func TestConditionals(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{"if (true) { 10 }", "10"},
+		{"if (true) { 10 } else { 20 }", "10"},
+		{"if (1 > 2) { 10 } else { 20 }", "20"},
+		{"if (1 > 2) { 10 }", "null"},
+		{"if (true) { }", "null"},
+		{"if (true) { let a = 1; }", "null"},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", "20"},
+		{"if (true) { let a = 5; }; a", "5"},
+	})
+}
+
+func TestGlobalsAndAssignment(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{"let one = 1; one", "1"},
+		{"let one = 1; let two = one + one; one + two", "3"},
+		{"let x = 1; let x = x + 1; x", "2"},
+		{"let x = 1; x = 5; x", "5"},
+		{"let x = 1; x += 5", "6"},
+		{"let x = 1; x -= 5; x", "-4"},
+		{"let x = 1; let y = x = 3; x + y", "6"},
+		{"x = 5", "ERROR: identifier not found: x"},
+		{"x", "ERROR: identifier not found: x"},
+		{"const x = 1; x = 2", "ERROR: cannot assign to constant x"},
+		{"const x = 1; let x = 2; x = 3", "ERROR: cannot redeclare constant x"},
+		{"const x = 1; const x = 2; x", "ERROR: cannot redeclare constant x"},
+		{"let f = fn() { const x = 1; let x = 2; x }; f()", "ERROR: cannot redeclare constant x"},
+		{"let x = 1; const x = 2; x = 3", "ERROR: cannot assign to constant x"},
+		{"const x = 1; let f = fn() { const x = 2; x }; f()", "2"},
+		{"let s = 0; for (i in [1, 2]) { const c = i * 10; s += c }; s", "30"},
+		{"len = 1", "ERROR: identifier not found: len"},
+		{`let s = "a"; s += 1`, "ERROR: type mismatch: STRING + INTEGER"},
+		{"let f = fn() { g() }; let g = fn() { 5 }; f()", "5"},
+	})
+}
+
+func TestCollections(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{"[]", "[]"},
+		{"[1, 2 * 2, 3 + 3]", "[1, 4, 6]"},
+		{"[1, 2, 3][1]", "2"},
+		{"[1, 2, 3][-1]", "3"},
+		{"[1, 2, 3][3]", "null"},
+		{`[1]["a"]`, "ERROR: array index must be INTEGER, got STRING"},
+		{"{}", "{}"},
+		{"{2: 3, 1: 4}", "{2: 3, 1: 4}"},
+		{`{"a": 1, "b": 2}["b"]`, "2"},
+		{"{1: 1}[2]", "null"},
+		{"{[1]: 1}", "ERROR: unusable as hash key: ARRAY"},
+		{"{1: 1}[[1]]", "ERROR: unusable as hash key: ARRAY"},
+		{"1[0]", "ERROR: index operator not supported: INTEGER"},
+		{"let a = [1, 2]; a[0] = 5; a", "[5, 2]"},
+		{"let a = [1, 2]; a[-1] += 5; a", "[1, 7]"},
+		{"let a = [1, 2]; a[2] = 5", "ERROR: index out of range: 2 with length 2"},
+		{`let h = {}; h["a"] = 1; h["a"] += 2; h`, "{a: 3}"},
+		{`let h = {}; h["a"] -= 2`, "ERROR: key not found: a"},
+		{"let s = 1; s[0] = 1", "ERROR: index assignment not supported: INTEGER"},
+		{"let a = [1]; let b = a; b[0] = 2; a", "[2]"},
+		{"let a = [" + strings.Repeat("1, ", 2999) + "1]; len(a)", "3000"},
+	})
+}
+
+func TestBuiltins(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{`len("four")`, "4"},
+		{"len([1, 2])", "2"},
+		{"len(1)", "ERROR: argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "ERROR: wrong number of arguments: want=1, got=2"},
+		{"first([1, 2])", "1"},
+		{"last([1, 2])", "2"},
+		{"rest([1, 2, 3])", "[2, 3]"},
+		{"push([], 1)", "[1]"},
+		{"first([])", "null"},
+		{`keys({"a": 1, "b": 2})`, "[a, b]"},
+		{`values({"a": 1})`, "[1]"},
+		{"let len = fn(x) { 42 }; len([])", "42"},
+		{"len(fn() {})", "ERROR: argument to `len` not supported, got FUNCTION"},
+	})
+}
+
+func TestFunctions(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{"let f = fn() { 5 + 10 }; f()", "15"},
+		{"fn() { 1 }()", "1"},
+		{"let f = fn() { return 99; 100 }; f()", "99"},
+		{"let f = fn() { }; f()", "null"},
+		{"let f = fn() { let a = 1; }; f()", "null"},
+		{"let f = fn(a, b) { a + b }; f(1, 2)", "3"},
+		{"let f = fn(a) { let b = a * 2; b + a }; f(2) + f(3)", "15"},
+		{"let f = fn(a) { a }; f()", "ERROR: wrong number of arguments: want=1, got=0"},
+		{"1()", "ERROR: not a function: INTEGER"},
+		{"let f = fn() { if (true) { return 1 }; 2 }; f()", "1"},
+		{"let f = fn(x) { if (x) { return } 2 }; [f(true), f(false)]", "[null, 2]"},
+		{"let f = fn() { return; 2 }; f()", "null"},
+		{"return 5; 6", "5"},
+		{"let g = 10; let f = fn() { let g = 1; g }; f() + g", "11"},
+		{"let f = fn() { y }; f()", "ERROR: identifier not found: y"},
+		{"let f = fn() { if (false) { let y = 1 }; y }; f()", "ERROR: identifier not found: y"},
+		{"let r = fn(n) { if (n == 0) { 0 } else { 1 + r(n - 1) } }; r(1000)", "1000"},
+		{"let f = fn(x) { x }; f", "fn(x) {\nx\n}"},
+		{"[fn(a, b) { let c = a; c + b }]", "[fn(a, b) {\nlet c = a;(c + b)\n}]"},
+	})
+}
+
+func TestClosures(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{"let adder = fn(a) { fn(b) { a + b } }; adder(2)(3)", "5"},
+		{"let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3)", "6"},
+		{`
+		let counter = fn() {
+			let n = 0;
+			fn() { n += 1 }
+		};
+		let c = counter();
+		c(); c();
+		let d = counter();
+		d();
+		c()`, "3"},
+		{`
+		let f = fn() {
+			let x = 1;
+			let get = fn() { x };
+			x = 2;
+			get()
+		};
+		f()`, "2"},
+		{`
+		let f = fn(x) {
+			let set = fn(v) { x = v };
+			set(5);
+			x
+		};
+		f(1)`, "5"},
+		{`
+		let outer = fn() {
+			let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+			fib(15)
+		};
+		outer()`, "610"},
+		{`
+		let outer = fn() {
+			let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+			let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+			even(10)
+		};
+		outer()`, "true"},
+		{"let fib = fn(n) { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) }; fib(20)", "6765"},
+		{"let f = fn() { let g = fn() { h }; let h = 1; g() }; f()", "1"},
+	})
+}
+
+func TestLoops(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{"let i = 0; while (i < 10) { i += 1 }; i", "10"},
+		{"let i = 0; while (true) { i += 1; if (i == 5) { break } }; i", "5"},
+		{`
+		let i = 0; let sum = 0;
+		while (i < 10) {
+			i += 1;
+			if (i % 2 == 0) { continue; }
+			sum += i;
+		}
+		sum`, "25"},
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x }; sum", "6"},
+		{`let s = ""; for (k in {"a": 1, "b": 2}) { s += k }; s`, "ab"},
+		{`let s = ""; for (c in "héllo") { s = c + s }; s`, "olléh"},
+		{"for (x in 5) { x }", "ERROR: cannot iterate over INTEGER"},
+		{"let a = [1, 2]; for (x in a) { a[0] = 5; push(a, 1) }; a", "[5, 2]"},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10 } } }; f()", "20"},
+		{"let f = fn() { let i = 0; while (true) { i += 1; if (i > 3) { return i } } }; f()", "4"},
+		{`
+		let fs = [];
+		for (x in [1, 2, 3]) { fs = push(fs, fn() { x }) }
+		fs[0]() + fs[1]() * 10 + fs[2]() * 100`, "321"},
+		{`
+		let fs = [];
+		let i = 0;
+		while (i < 3) { let j = i; fs = push(fs, fn() { j }); i += 1 }
+		fs[0]() + fs[1]() * 10 + fs[2]() * 100`, "210"},
+		{"for (x in [1]) { let y = 2 }; y", "ERROR: identifier not found: y"},
+		{"let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break } n += 1 } }; n", "2"},
+		{"let i = 0; while (i < 3) { let y = if (true) { break }; i += 1 }; i", "0"},
+		{"let s = 0; for (x in [1, 2, 3]) { s += if (x == 2) { continue } else { x } }; s", "4"},
+		{"let n = 0; for (x in [1, 2, 3]) { let a = [x, if (x == 2) { continue }]; n += 1 }; n", "2"},
+		{"let f = fn() { let y = if (true) { return 5 }; 0 }; f()", "5"},
+	})
+}
+
+func TestExceptions(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{`throw "boom"`, "ERROR: boom"},
+		{"throw 42", "ERROR: 42"},
+		{`try { throw "boom" } catch (e) { e["message"] }`, "boom"},
+		{`try { throw 42 } catch (e) { e["value"] + 1 }`, "43"},
+		{`try { 1 / 0 } catch (e) { e["value"] }`, "division by zero"},
+		{`try { 1 / 0 } catch (e) { e["line"] + e["column"] }`, "8"},
+		{`try { throw 1 } catch (e) { e[1] }`, "ERROR: error field must be STRING, got INTEGER"},
+		{`try { throw 1 } catch (e) { e["nope"] }`, "null"},
+		{"try { 1 } catch (e) { 2 }", "1"},
+		{"try { throw 1 } catch (e) { e }", "ERROR: 1"},
+		{"let x = 0; try { x = 1 } finally { x = 2 }; x", "2"},
+		{"let x = 0; try { 5 } finally { x = 2 }", "5"},
+		{"let x = 0; try { throw 1 } finally { x = 2 }", "ERROR: 1"},
+		{"let x = 0; try { try { throw 1 } finally { x += 1 } } catch (e) { x += 10 }; x", "11"},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", "2"},
+		{"let x = 0; let f = fn() { try { return 1 } finally { x = 5 } }; f() + x", "6"},
+		{"try { throw 1 } catch (e) { throw 2 }", "ERROR: 2"},
+		{"try { throw 1 } catch (e) { throw 2 } finally { throw 3 }", "ERROR: 3"},
+		{"try { try { throw 1 } catch (e) { throw e } } catch (e) { e[\"value\"] }", "1"},
+		{`
+		let f = fn() { throw "deep" };
+		let g = fn() { f() };
+		try { g() } catch (e) { e["message"] }`, "deep"},
+		{`
+		let n = 0;
+		while (true) {
+			try { n += 1; if (n > 3) { break } } finally { n += 10 }
+		}
+		n`, "22"},
+		{`
+		let n = 0;
+		for (x in [1, 2, 3]) {
+			try { if (x == 2) { continue } n += x } catch (e) { 0 } finally { n += 100 }
+		}
+		n`, "304"},
+		{"let f = fn() { try { throw 1 } catch (e) { return 5 } finally { 6 } }; f()", "5"},
+		{"try { x } catch (e) { e[\"message\"] }", "identifier not found: x"},
+		{"let e = 1; try { throw 2 } catch (e) { e }; e", "1"},
+		{"try { let t = 1 } finally { 2 }; t", "1"},
+	})
+}
+
+func TestErrorPositionsAndStacks(t *testing.T) {
+	inputs := []string{
+		"let x = 1;\nx + true",
+		"let x = 1;\n(x + 1) * true",
+		"let f = fn(x) { x + true };\n\nf(1)",
+		"let add = fn(a, b) {\n  a + b\n};\nlet g = fn() { add(1, \"s\") };\ng()",
+		"let f = fn() { throw \"boom\" };\nlet h = fn() { try { f() } catch (e) { throw e } };\nh()",
+		"let f = fn() { try { throw 1 } finally { 2 } };\nf()",
+		"let f = fn() { len(1) };\nf()",
+	}
+	for _, input := range inputs {
+		program := parse(t, input)
+		evaluated, ok := evaluator.Eval(program, object.NewEnvironment()).(*object.Error)
+		if !ok {
+			t.Fatalf("evaluator gave no error for %q", input)
+		}
+		err := runVm(t, input)
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			t.Fatalf("vm gave no error for %q, got %v", input, err)
+		}
+		if evaluated.Trace() != errObj.Trace() {
+			t.Errorf("traces differ for %q.\nevaluator:\n%s\nvm:\n%s", input, evaluated.Trace(), errObj.Trace())
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	err := runVm(t, "let r = fn(n) { r(n + 1) }; r(0)")
+	errObj, ok := err.(*object.Error)
+	if !ok || errObj.Message != "stack overflow" {
+		t.Fatalf("expected stack overflow, got %v", err)
+	}
+	if len(errObj.Stack) != MaxFrames-1 {
+		t.Errorf("wrong stack length. want=%d, got=%d", MaxFrames-1, len(errObj.Stack))
+	}
+}
+
+// lines of the REPL share the globals, the symbol table and the constants
+func TestGlobalsStore(t *testing.T) {
+	globals := make([]object.Object, GlobalsSize)
+	constants := []object.Object{}
+	symbolTable := compiler.New().SymbolTable()
+
+	lines := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1;", ""},
+		{"let f = fn(x) { x + a };", ""},
+		{"a = 5; f(1)", "6"},
+	}
+	for _, line := range lines {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(t, line.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobalsStore(bytecode, globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if line.expected != "" && machine.LastPoppedStackElem().Inspect() != line.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", line.input, line.expected, machine.LastPoppedStackElem().Inspect())
+		}
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		evaluated := evaluator.Eval(parse(t, tt.input), object.NewEnvironment())
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("evaluator gave wrong result for %q. want=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+
+		var result string
+		if err := runVm(t, tt.input); err != nil {
+			errObj, ok := err.(*object.Error)
+			if !ok {
+				t.Fatalf("vm failed for %q: %s", tt.input, err)
+			}
+			result = errObj.Inspect()
+		} else {
+			result = lastPopped.Inspect()
+		}
+		if result != tt.expected {
+			t.Errorf("vm gave wrong result for %q. want=%s, got=%s", tt.input, tt.expected, result)
+		}
+	}
+}
+
+var lastPopped object.Object
+
+func runVm(t *testing.T, input string) error {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error for %q: %s", input, err)
+	}
+	vm := New(comp.Bytecode())
+	err := vm.Run()
+	lastPopped = vm.LastPoppedStackElem()
+	return err
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors for %q: %v", input, p.Errors())
+	}
+	return program
+}